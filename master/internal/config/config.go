@@ -82,6 +82,22 @@ type WebhooksConfig struct {
 	SigningKey string `json:"signing_key"`
 }
 
+// CheckpointDownloadConfig hosts configuration fields for downloading checkpoints through the
+// master.
+type CheckpointDownloadConfig struct {
+	// S3Concurrency is the number of S3 objects fetched concurrently while assembling an archive.
+	S3Concurrency int `json:"s3_concurrency"`
+}
+
+// Validate implements the check.Validatable interface.
+func (c *CheckpointDownloadConfig) Validate() []error {
+	var errs []error
+	if c.S3Concurrency < 1 {
+		errs = append(errs, errors.New("s3_concurrency must be greater than 0"))
+	}
+	return errs
+}
+
 // DefaultConfig returns the default configuration of the master.
 func DefaultConfig() *Config {
 	return &Config{
@@ -128,6 +144,9 @@ func DefaultConfig() *Config {
 			CoresPerWorker: 1,
 			MaxTrees:       100,
 		},
+		CheckpointDownload: CheckpointDownloadConfig{
+			S3Concurrency: 8,
+		},
 		ResourceConfig: DefaultResourceConfig(),
 	}
 }
@@ -155,6 +174,7 @@ type Config struct {
 	Observability         ObservabilityConfig               `json:"observability"`
 	Cache                 CacheConfig                       `json:"cache"`
 	Webhooks              WebhooksConfig                    `json:"webhooks"`
+	CheckpointDownload    CheckpointDownloadConfig          `json:"checkpoint_download"`
 	FeatureSwitches       []string                          `json:"feature_switches"`
 	*ResourceConfig
 
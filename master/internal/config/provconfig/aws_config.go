@@ -3,7 +3,9 @@ package provconfig
 import (
 	"encoding/json"
 	"fmt"
+	"net/http"
 	"strings"
+	"time"
 	"unicode"
 
 	"github.com/aws/aws-sdk-go/aws"
@@ -14,6 +16,7 @@ import (
 	"github.com/determined-ai/determined/master/pkg"
 	"github.com/determined-ai/determined/master/pkg/check"
 	"github.com/determined-ai/determined/master/pkg/device"
+	"github.com/determined-ai/determined/master/pkg/model"
 )
 
 // SpotPriceNotSetPlaceholder set placeholder.
@@ -23,8 +26,16 @@ const SpotPriceNotSetPlaceholder = "OnDemand"
 type AWSClusterConfig struct {
 	Region string `json:"region"`
 
-	RootVolumeSize int    `json:"root_volume_size"`
-	ImageID        string `json:"image_id"`
+	RootVolumeSize       int      `json:"root_volume_size"`
+	RootVolumeType       string   `json:"root_volume_type"`
+	RootVolumeIOPS       *int     `json:"root_volume_iops,omitempty"`
+	RootVolumeThroughput *int     `json:"root_volume_throughput,omitempty"`
+	ImageID              string   `json:"image_id"`
+	AllowedAMIOwners     []string `json:"allowed_ami_owners"`
+
+	LaunchTemplateID       string `json:"launch_template_id"`
+	LaunchTemplateVersion  string `json:"launch_template_version"`
+	LaunchTemplateOverride bool   `json:"launch_template_override"`
 
 	TagKey       string `json:"tag_key"`
 	TagValue     string `json:"tag_value"`
@@ -43,11 +54,20 @@ type AWSClusterConfig struct {
 	SpotEnabled  bool   `json:"spot"`
 	SpotMaxPrice string `json:"spot_max_price"`
 
+	MinInstanceLifetime model.Duration `json:"min_instance_lifetime"`
+
 	CustomTags []*ec2Tag `json:"custom_tags"`
 
 	CPUSlotsAllowed bool `json:"cpu_slots_allowed"`
 }
 
+// Instance architectures, named as EC2 names them.
+const (
+	ArchX86_64 = "x86_64"
+	ArchArm64  = "arm64"
+)
+
+// defaultAWSImageID maps regions to the default Determined agent AMIs, which are all x86_64.
 var defaultAWSImageID = map[string]string{
 	"ap-northeast-1": "ami-0efbc837b3c729df1",
 	"ap-northeast-2": "ami-0934d35fc17d76abc",
@@ -61,9 +81,24 @@ var defaultAWSImageID = map[string]string{
 	"eu-west-1":      "ami-04eab4dc55258e621",
 }
 
+// SSMImageIDPrefix marks an image ID as a reference to an SSM parameter holding the AMI ID, e.g.
+// "resolve:ssm:/aws/service/ecs/optimized-ami/amazon-linux-2/gpu/recommended/image_id".
+const SSMImageIDPrefix = "resolve:ssm:"
+
+// DefaultAWSImageID returns the default Determined agent AMI ID for the region and architecture.
+// There are no default AMIs for arm64, so arm64 instance types (e.g., g5g) require an image_id.
+func DefaultAWSImageID(region, arch string) (string, bool) {
+	if arch != ArchX86_64 {
+		return "", false
+	}
+	imageID, ok := defaultAWSImageID[region]
+	return imageID, ok
+}
+
 var defaultAWSClusterConfig = AWSClusterConfig{
 	InstanceName:   "determined-ai-agent",
 	RootVolumeSize: 200,
+	RootVolumeType: "gp2",
 	TagKey:         "managed_by",
 	NetworkInterface: ec2NetworkInterface{
 		PublicIP: true,
@@ -102,11 +137,14 @@ func (c *AWSClusterConfig) InitDefaultValues() error {
 		c.SpotMaxPrice = SpotPriceNotSetPlaceholder
 	}
 
-	if len(c.ImageID) == 0 {
-		if v, ok := defaultAWSImageID[c.Region]; ok {
+	// Instances launched from a launch template use the template's AMI unless one is configured.
+	if len(c.ImageID) == 0 && len(c.LaunchTemplateID) == 0 {
+		arch := c.Architecture()
+		if v, ok := DefaultAWSImageID(c.Region, arch); ok {
 			c.ImageID = v
 		} else {
-			return errors.Errorf("cannot find default image ID in the region %s", c.Region)
+			return errors.Errorf("cannot find default %s image ID in the region %s; "+
+				"set 'image_id' to use instance type %s", arch, c.Region, c.InstanceType.Name())
 		}
 	}
 
@@ -128,7 +166,57 @@ func (c *AWSClusterConfig) InitDefaultValues() error {
 func (c *AWSClusterConfig) UnmarshalJSON(data []byte) error {
 	*c = defaultAWSClusterConfig
 	type DefaultParser *AWSClusterConfig
-	return json.Unmarshal(data, DefaultParser(c))
+	if err := json.Unmarshal(data, DefaultParser(c)); err != nil {
+		return err
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	// If cpu_slots_allowed is not set, allow CPU slots for instance types without GPUs so that the
+	// pool doesn't silently provision instances that can't run any slot-requiring tasks.
+	if _, ok := fields["cpu_slots_allowed"]; !ok {
+		c.CPUSlotsAllowed = c.hasNoGPUs()
+	}
+	// Instances launched from a launch template keep the template's root volume unless the root
+	// volume is configured, so the defaults for its size and type do not apply.
+	if len(c.LaunchTemplateID) > 0 {
+		if _, ok := fields["root_volume_size"]; !ok {
+			c.RootVolumeSize = 0
+		}
+		if _, ok := fields["root_volume_type"]; !ok {
+			c.RootVolumeType = ""
+		}
+	}
+	return nil
+}
+
+// hasNoGPUs returns true if the instance type is known to have no GPUs, either because it is a
+// CPU instance type or because instance_slots is set to 0.
+func (c AWSClusterConfig) hasNoGPUs() bool {
+	slots, ok := c.instanceTypeSlots()
+	return ok && slots == 0
+}
+
+// instanceTypeSlots returns the number of slots of the instance type, falling back to the
+// configured instance_slots for instance types that are not known. It returns false if the number
+// of slots is not known either way.
+func (c AWSClusterConfig) instanceTypeSlots() (int, bool) {
+	if slots, ok := ec2InstanceSlots[c.InstanceType]; ok {
+		return slots, true
+	}
+	if c.InstanceSlots != nil {
+		return *c.InstanceSlots, true
+	}
+	return 0, false
+}
+
+// EffectiveInstanceType returns the instance type with the number of slots this configuration
+// resolves it to, including any instance_slots override.
+func (c AWSClusterConfig) EffectiveInstanceType() model.InstanceType {
+	slots, _ := c.instanceTypeSlots()
+	return ec2InstanceTypeWithSlots{Ec2InstanceType: c.InstanceType, slots: slots}
 }
 
 func validateInstanceTypeSlots(c AWSClusterConfig) error {
@@ -143,10 +231,15 @@ func validateInstanceTypeSlots(c AWSClusterConfig) error {
 		if *instanceSlots < 0 {
 			return errors.Errorf("ec2 'instance_slots' must be greater than or equal to 0")
 		}
-		ec2InstanceSlots[instanceType] = *instanceSlots
 		return nil
 	}
 
+	if instanceType.isCPUFamily() {
+		return errors.Errorf("ec2 'instance_type' %s looks like a CPU instance type but is not "+
+			"one of the known types; set 'instance_slots' to 0 and 'cpu_slots_allowed' to true "+
+			"to use each instance as a single CPU slot", instanceType.Name())
+	}
+
 	strs := make([]string, 0, len(ec2InstanceSlots))
 	for t := range ec2InstanceSlots {
 		strs = append(strs, t.Name())
@@ -161,17 +254,35 @@ func (c AWSClusterConfig) Validate() []error {
 	if c.SpotEnabled && c.SpotMaxPrice != SpotPriceNotSetPlaceholder {
 		spotPriceIsNotValidNumberErr = validateMaxSpotPrice(c.SpotMaxPrice)
 	}
+	var rootVolumeSizeErr error
+	if len(c.LaunchTemplateID) == 0 || c.RootVolumeSize != 0 {
+		rootVolumeSizeErr = check.GreaterThanOrEqualTo(
+			c.RootVolumeSize, 100, "ec2 root volume size must be >= 100")
+	}
+	var sshKeyNameIsEmptyErr error
+	if len(c.LaunchTemplateID) == 0 {
+		sshKeyNameIsEmptyErr = check.GreaterThan(
+			len(c.SSHKeyName), 0, "ec2 key name must be non-empty")
+	}
 	return []error{
-		check.GreaterThan(len(c.SSHKeyName), 0, "ec2 key name must be non-empty"),
-		check.GreaterThanOrEqualTo(c.RootVolumeSize, 100, "ec2 root volume size must be >= 100"),
+		sshKeyNameIsEmptyErr,
+		check.False(c.SpotEnabled && len(c.LaunchTemplateID) > 0,
+			"ec2 launch templates cannot be used with spot instances"),
+		check.False(len(c.LaunchTemplateVersion) > 0 && len(c.LaunchTemplateID) == 0,
+			"ec2 launch template version requires a launch template ID"),
+		rootVolumeSizeErr,
+		validateRootVolume(c),
+		validateSubnets(c.NetworkInterface),
 		spotPriceIsNotValidNumberErr,
+		check.GreaterThanOrEqualTo(int64(c.MinInstanceLifetime), int64(0),
+			"ec2 min instance lifetime must be greater than or equal to 0"),
 		validateInstanceTypeSlots(c),
 	}
 }
 
 // SlotsPerInstance returns the number of slots per instance.
 func (c AWSClusterConfig) SlotsPerInstance() int {
-	slots := c.InstanceType.Slots()
+	slots, _ := c.instanceTypeSlots()
 	if slots == 0 && c.CPUSlotsAllowed {
 		slots = 1
 	}
@@ -181,7 +292,7 @@ func (c AWSClusterConfig) SlotsPerInstance() int {
 
 // SlotType returns the type of the slot.
 func (c AWSClusterConfig) SlotType() device.Type {
-	slots := c.InstanceType.Slots()
+	slots, _ := c.instanceTypeSlots()
 	if slots > 0 {
 		return device.CUDA
 	}
@@ -191,9 +302,53 @@ func (c AWSClusterConfig) SlotType() device.Type {
 	return device.ZeroSlot
 }
 
+// Architecture returns the processor architecture of the instance type, which determines the
+// default agent AMI.
+func (c AWSClusterConfig) Architecture() string {
+	return c.InstanceType.Architecture()
+}
+
 // Accelerator returns the GPU accelerator for the instance.
 func (c AWSClusterConfig) Accelerator() string {
-	return c.InstanceType.Accelerator()
+	slots, _ := c.instanceTypeSlots()
+	return c.InstanceType.accelerator(slots)
+}
+
+// ec2RootVolumeTypes lists the supported EBS volume types for the root volume and whether they
+// accept provisioned IOPS and throughput.
+var ec2RootVolumeTypes = map[string]struct{ iops, throughput bool }{
+	"gp2": {iops: false, throughput: false},
+	"gp3": {iops: true, throughput: true},
+	"io1": {iops: true, throughput: false},
+	"io2": {iops: true, throughput: false},
+}
+
+func validateRootVolume(c AWSClusterConfig) error {
+	volumeType, ok := ec2RootVolumeTypes[c.RootVolumeType]
+	switch {
+	case c.RootVolumeType == "" && len(c.LaunchTemplateID) > 0:
+		// The launch template's volume type is unknown, so IOPS and throughput cannot be checked.
+		if c.RootVolumeIOPS != nil || c.RootVolumeThroughput != nil {
+			return errors.Errorf("ec2 'root_volume_type' is required to set " +
+				"'root_volume_iops' or 'root_volume_throughput'")
+		}
+	case !ok:
+		return errors.Errorf("ec2 'root_volume_type' must be one of gp2, gp3, io1, or io2, got %q",
+			c.RootVolumeType)
+	case c.RootVolumeIOPS != nil && !volumeType.iops:
+		return errors.Errorf("ec2 'root_volume_iops' is not supported for %s volumes",
+			c.RootVolumeType)
+	case c.RootVolumeThroughput != nil && !volumeType.throughput:
+		return errors.Errorf("ec2 'root_volume_throughput' is not supported for %s volumes",
+			c.RootVolumeType)
+	case c.RootVolumeIOPS == nil && (c.RootVolumeType == "io1" || c.RootVolumeType == "io2"):
+		return errors.Errorf("ec2 'root_volume_iops' is required for %s volumes", c.RootVolumeType)
+	case c.RootVolumeIOPS != nil && *c.RootVolumeIOPS <= 0:
+		return errors.Errorf("ec2 'root_volume_iops' must be greater than 0")
+	case c.RootVolumeThroughput != nil && *c.RootVolumeThroughput <= 0:
+		return errors.Errorf("ec2 'root_volume_throughput' must be greater than 0")
+	}
+	return nil
 }
 
 func validateMaxSpotPrice(spotMaxPriceInput string) error {
@@ -221,9 +376,83 @@ func validateMaxSpotPrice(spotMaxPriceInput string) error {
 }
 
 type ec2NetworkInterface struct {
-	PublicIP        bool   `json:"public_ip"`
-	SubnetID        string `json:"subnet_id"`
-	SecurityGroupID string `json:"security_group_id"`
+	PublicIP bool `json:"public_ip"`
+	// SubnetID is the first of the configured subnets. SubnetIDs is only set if subnet_id is
+	// configured as a list.
+	SubnetID        string   `json:"subnet_id"`
+	SubnetIDs       []string `json:"-"`
+	SecurityGroupID string   `json:"security_group_id"`
+}
+
+// Subnets returns the IDs of the configured subnets in the order they should be tried.
+func (n ec2NetworkInterface) Subnets() []string {
+	if len(n.SubnetIDs) > 0 {
+		return n.SubnetIDs
+	}
+	if n.SubnetID != "" {
+		return []string{n.SubnetID}
+	}
+	return nil
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface. subnet_id may be either a single
+// subnet ID or a list of them.
+func (n *ec2NetworkInterface) UnmarshalJSON(data []byte) error {
+	type DefaultParser ec2NetworkInterface
+	parsed := struct {
+		*DefaultParser
+		SubnetID json.RawMessage `json:"subnet_id"`
+	}{DefaultParser: (*DefaultParser)(n)}
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		return err
+	}
+	if len(parsed.SubnetID) == 0 || string(parsed.SubnetID) == "null" {
+		return nil
+	}
+
+	var subnetID string
+	if err := json.Unmarshal(parsed.SubnetID, &subnetID); err == nil {
+		n.SubnetID = subnetID
+		n.SubnetIDs = nil
+		return nil
+	}
+	var subnetIDs []string
+	if err := json.Unmarshal(parsed.SubnetID, &subnetIDs); err != nil {
+		return errors.New("ec2 'subnet_id' must be a subnet ID or a list of subnet IDs")
+	}
+	n.SubnetID = ""
+	if len(subnetIDs) > 0 {
+		n.SubnetID = subnetIDs[0]
+	}
+	n.SubnetIDs = subnetIDs
+	return nil
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (n ec2NetworkInterface) MarshalJSON() ([]byte, error) {
+	type DefaultParser ec2NetworkInterface
+	var subnetID interface{} = n.SubnetID
+	if len(n.SubnetIDs) > 1 {
+		subnetID = n.SubnetIDs
+	}
+	return json.Marshal(struct {
+		DefaultParser
+		SubnetID interface{} `json:"subnet_id"`
+	}{DefaultParser: DefaultParser(n), SubnetID: subnetID})
+}
+
+func validateSubnets(n ec2NetworkInterface) error {
+	seen := map[string]bool{}
+	for _, subnetID := range n.SubnetIDs {
+		switch {
+		case subnetID == "":
+			return errors.New("ec2 'subnet_id' must not contain empty subnet IDs")
+		case seen[subnetID]:
+			return errors.Errorf("ec2 'subnet_id' contains subnet %s more than once", subnetID)
+		}
+		seen[subnetID] = true
+	}
+	return nil
 }
 
 type ec2Tag struct {
@@ -247,37 +476,100 @@ func (t Ec2InstanceType) Slots() int {
 	return 0
 }
 
-// Accelerator source:
-// https://docs.aws.amazon.com/AWSEC2/latest/UserGuide/accelerated-computing-instances.html
-func (t Ec2InstanceType) Accelerator() string {
-	instanceType := t.Name()
-	numGpu := t.Slots()
-	accelerator := ""
-	if strings.HasPrefix(instanceType, "p2") {
-		accelerator = "NVIDIA Tesla K80"
-	}
-	if strings.HasPrefix(instanceType, "p3") {
-		accelerator = "NVIDIA Tesla V100"
-	}
-	if strings.HasPrefix(instanceType, "p4d") {
-		accelerator = "NVIDIA A100"
-	}
-	if strings.HasPrefix(instanceType, "g3") {
-		accelerator = "NVIDIA Tesla M60"
-	}
-	if strings.HasPrefix(instanceType, "g5g") {
-		accelerator = "NVIDIA T4G"
-	}
-	if strings.HasPrefix(instanceType, "g5") {
-		accelerator = "NVIDIA A10G"
+// ec2InstanceTypeWithSlots is an instance type whose number of slots has been resolved by a
+// cluster configuration.
+type ec2InstanceTypeWithSlots struct {
+	Ec2InstanceType
+	slots int
+}
+
+// Slots returns number of slots.
+func (t ec2InstanceTypeWithSlots) Slots() int {
+	return t.slots
+}
+
+// family returns the instance family of the instance type, e.g. "c5" for "c5.xlarge".
+func (t Ec2InstanceType) family() string {
+	return strings.SplitN(t.Name(), ".", 2)[0]
+}
+
+// ec2Arm64Families lists the instance families that run on AWS Graviton (arm64) processors. All
+// other instance families are assumed to be x86_64.
+var ec2Arm64Families = []string{
+	"a1",
+	"c6g", "c6gd", "c6gn", "c7g", "c7gd", "c7gn",
+	"g5g",
+	"hpc7g",
+	"im4gn", "is4gen",
+	"m6g", "m6gd", "m7g", "m7gd",
+	"r6g", "r6gd", "r7g", "r7gd",
+	"t4g",
+	"x2gd",
+}
+
+// Architecture returns the processor architecture of the instance type.
+func (t Ec2InstanceType) Architecture() string {
+	family := t.family()
+	for _, arm64Family := range ec2Arm64Families {
+		if family == arm64Family {
+			return ArchArm64
+		}
 	}
-	if strings.HasPrefix(instanceType, "g4dn") {
-		accelerator = "NVIDIA T4 Tensor Core"
+	return ArchX86_64
+}
+
+// isCPUFamily returns true if the instance type belongs to a known family of instances without
+// GPUs.
+func (t Ec2InstanceType) isCPUFamily() bool {
+	family := t.family()
+	for known, slots := range ec2InstanceSlots {
+		if known.family() == family && slots == 0 {
+			return true
+		}
 	}
-	if accelerator == "" {
-		return ""
+	return false
+}
+
+// ec2Accelerators maps instance type prefixes to the accelerators they provide. More specific
+// prefixes must come before the prefixes they start with, e.g., "g5g" before "g5".
+// Source: https://docs.aws.amazon.com/AWSEC2/latest/UserGuide/accelerated-computing-instances.html
+var ec2Accelerators = []struct {
+	prefix string
+	name   string
+}{
+	{"p2", "NVIDIA Tesla K80"},
+	{"p3", "NVIDIA Tesla V100"},
+	{"p4de", "NVIDIA A100 80GB"},
+	{"p4d", "NVIDIA A100"},
+	{"p5", "NVIDIA H100"},
+	{"g3", "NVIDIA Tesla M60"},
+	{"g4dn", "NVIDIA T4 Tensor Core"},
+	{"g5g", "NVIDIA T4G"},
+	{"g5", "NVIDIA A10G"},
+	{"g6e", "NVIDIA L40S"},
+	{"g6", "NVIDIA L4"},
+	{"trn1", "AWS Trainium (Neuron)"},
+	{"inf2", "AWS Inferentia2 (Neuron)"},
+}
+
+// Accelerator returns the number and name of the accelerators of the instance type, or an empty
+// string if it has none.
+func (t Ec2InstanceType) Accelerator() string {
+	return t.accelerator(t.Slots())
+}
+
+func (t Ec2InstanceType) accelerator(numGpu int) string {
+	instanceType := t.Name()
+	for _, accelerator := range ec2Accelerators {
+		if !strings.HasPrefix(instanceType, accelerator.prefix) {
+			continue
+		}
+		if numGpu > 0 {
+			return fmt.Sprintf("%d x %s", numGpu, accelerator.name)
+		}
+		return accelerator.name
 	}
-	return fmt.Sprintf("%d x %s", numGpu, accelerator)
+	return ""
 }
 
 // This map tracks how many slots are available in each instance type. It also
@@ -300,6 +592,22 @@ var ec2InstanceSlots = map[Ec2InstanceType]int{
 	"g5.12xlarge":   4,
 	"g5.24xlarge":   4,
 	"g5.48xlarge":   8,
+	"g6.xlarge":     1,
+	"g6.2xlarge":    1,
+	"g6.4xlarge":    1,
+	"g6.8xlarge":    1,
+	"g6.16xlarge":   1,
+	"g6.12xlarge":   4,
+	"g6.24xlarge":   4,
+	"g6.48xlarge":   8,
+	"g6e.xlarge":    1,
+	"g6e.2xlarge":   1,
+	"g6e.4xlarge":   1,
+	"g6e.8xlarge":   1,
+	"g6e.16xlarge":  1,
+	"g6e.12xlarge":  4,
+	"g6e.24xlarge":  4,
+	"g6e.48xlarge":  8,
 	"p2.xlarge":     1,
 	"p2.8xlarge":    8,
 	"p2.16xlarge":   16,
@@ -308,6 +616,8 @@ var ec2InstanceSlots = map[Ec2InstanceType]int{
 	"p3.16xlarge":   8,
 	"p3dn.24xlarge": 8,
 	"p4d.24xlarge":  8,
+	"p4de.24xlarge": 8,
+	"p5.48xlarge":   8,
 	"t2.medium":     0,
 	"t2.large":      0,
 	"t2.xlarge":     0,
@@ -392,12 +702,30 @@ var ec2InstanceSlots = map[Ec2InstanceType]int{
 	"m5zn.12xlarge": 0,
 }
 
+// ec2MetadataTimeout bounds each request to the instance metadata service so that looking up
+// metadata off of EC2 fails quickly instead of holding up master startup.
+const ec2MetadataTimeout = time.Second
+
 func getEC2MetadataSess() (*ec2metadata.EC2Metadata, error) {
+	return newEC2MetadataClient("")
+}
+
+// newEC2MetadataClient returns a client for the instance metadata service at the endpoint, or at
+// the default endpoint if it is empty. Requests time out after ec2MetadataTimeout and are retried
+// once, so that the lookup fails quickly when the metadata service is unreachable.
+func newEC2MetadataClient(endpoint string) (*ec2metadata.EC2Metadata, error) {
 	sess, err := session.NewSession(&aws.Config{})
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to create AWS session")
 	}
-	return ec2metadata.New(sess), nil
+	config := &aws.Config{
+		HTTPClient: &http.Client{Timeout: ec2MetadataTimeout},
+		MaxRetries: aws.Int(1),
+	}
+	if endpoint != "" {
+		config.Endpoint = aws.String(endpoint)
+	}
+	return ec2metadata.New(sess, config), nil
 }
 
 func getEC2Metadata(field string) (string, error) {
@@ -2,7 +2,11 @@ package provconfig
 
 import (
 	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/ghodss/yaml"
 	"gotest.tools/assert"
@@ -70,6 +74,7 @@ func TestUnmarshalAWSClusterConfig(t *testing.T) {
 			TagKey:                "dai",
 			TagValue:              "agent",
 			RootVolumeSize:        120,
+			RootVolumeType:        "gp2",
 			InstanceType:          "p2.xlarge",
 			IamInstanceProfileArn: "test_instance_profile",
 			CustomTags: []*ec2Tag{
@@ -96,3 +101,244 @@ func TestAWSClusterConfigMissingFields(t *testing.T) {
 	err = check.Validate(&config)
 	assert.ErrorContains(t, err, "non-empty")
 }
+
+func TestAWSClusterConfigCPUSlotsAllowedInference(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		json     string
+		expected bool
+	}{
+		{"gpu instance type", `{"instance_type": "p3.2xlarge"}`, false},
+		{"cpu instance type", `{"instance_type": "m5.large"}`, true},
+		{"cpu instance type opt-out", `{"instance_type": "m5.large", "cpu_slots_allowed": false}`, false},
+		{"gpu instance type opt-in", `{"instance_type": "p3.2xlarge", "cpu_slots_allowed": true}`, true},
+		{"zero instance slots", `{"instance_type": "c6i.large", "instance_slots": 0}`, true},
+		{"nonzero instance slots", `{"instance_type": "p5.48xlarge", "instance_slots": 8}`, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var config AWSClusterConfig
+			assert.NilError(t, json.Unmarshal([]byte(tc.json), &config))
+			assert.Equal(t, config.CPUSlotsAllowed, tc.expected)
+		})
+	}
+}
+
+func TestAWSClusterConfigUnknownCPUInstanceType(t *testing.T) {
+	var config AWSClusterConfig
+	err := json.Unmarshal([]byte(`
+{
+	"ssh_key_name": "test-key",
+	"instance_type": "m5.metal"
+}`), &config)
+	assert.NilError(t, err)
+	err = check.Validate(&config)
+	assert.ErrorContains(t, err, "set 'instance_slots' to 0 and 'cpu_slots_allowed' to true")
+}
+
+func TestAWSClusterConfigLaunchTemplate(t *testing.T) {
+	var config AWSClusterConfig
+	err := json.Unmarshal([]byte(`{"launch_template_id": "lt-123"}`), &config)
+	assert.NilError(t, err)
+	assert.NilError(t, check.Validate(&config))
+	// The root volume is left to the launch template unless it is configured.
+	assert.Equal(t, config.RootVolumeSize, 0)
+	assert.Equal(t, config.RootVolumeType, "")
+
+	config.SpotEnabled = true
+	assert.ErrorContains(t, check.Validate(&config), "cannot be used with spot instances")
+
+	config = AWSClusterConfig{}
+	err = json.Unmarshal([]byte(`{"ssh_key_name": "key", "launch_template_version": "3"}`), &config)
+	assert.NilError(t, err)
+	assert.ErrorContains(t, check.Validate(&config), "requires a launch template ID")
+
+	config = AWSClusterConfig{}
+	err = json.Unmarshal([]byte(`{"launch_template_id": "lt-123", "root_volume_size": 50}`), &config)
+	assert.NilError(t, err)
+	assert.ErrorContains(t, check.Validate(&config), "root volume size must be >= 100")
+
+	config = AWSClusterConfig{}
+	err = json.Unmarshal([]byte(`{"launch_template_id": "lt-123", "root_volume_iops": 4000}`),
+		&config)
+	assert.NilError(t, err)
+	assert.ErrorContains(t, check.Validate(&config), "'root_volume_type' is required")
+}
+
+func TestEc2InstanceTypeAccelerator(t *testing.T) {
+	for instanceType, expected := range map[Ec2InstanceType]string{
+		"p3.8xlarge":    "4 x NVIDIA Tesla V100",
+		"p4d.24xlarge":  "8 x NVIDIA A100",
+		"p4de.24xlarge": "8 x NVIDIA A100 80GB",
+		"p5.48xlarge":   "8 x NVIDIA H100",
+		"g5g.xlarge":    "NVIDIA T4G",
+		"g5.12xlarge":   "4 x NVIDIA A10G",
+		"g6.xlarge":     "1 x NVIDIA L4",
+		"g6e.48xlarge":  "8 x NVIDIA L40S",
+		"trn1.32xlarge": "AWS Trainium (Neuron)",
+		"inf2.xlarge":   "AWS Inferentia2 (Neuron)",
+		"m5.large":      "",
+	} {
+		assert.Equal(t, instanceType.Accelerator(), expected, instanceType)
+	}
+}
+
+func TestEC2MetadataUsesIMDSv2(t *testing.T) {
+	const token = "test-token"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPut && r.URL.Path == "/latest/api/token":
+			ttl := r.Header.Get("X-aws-ec2-metadata-token-ttl-seconds")
+			if ttl == "" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			// The SDK only uses the token if the response carries its TTL.
+			w.Header().Set("X-aws-ec2-metadata-token-ttl-seconds", ttl)
+			_, _ = w.Write([]byte(token))
+		case r.Header.Get("X-aws-ec2-metadata-token") != token:
+			w.WriteHeader(http.StatusUnauthorized)
+		case r.URL.Path == "/latest/meta-data/local-ipv4":
+			_, _ = w.Write([]byte("10.0.0.1"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	client, err := newEC2MetadataClient(server.URL)
+	assert.NilError(t, err)
+	ip, err := client.GetMetadata("local-ipv4")
+	assert.NilError(t, err)
+	assert.Equal(t, ip, "10.0.0.1")
+}
+
+func TestEC2MetadataUnavailableFailsFast(t *testing.T) {
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-done
+	}))
+	defer server.Close()
+	defer close(done)
+
+	client, err := newEC2MetadataClient(server.URL)
+	assert.NilError(t, err)
+	start := time.Now()
+	assert.Assert(t, !client.Available())
+	assert.Assert(t, time.Since(start) < 10*ec2MetadataTimeout)
+}
+
+func TestDefaultAWSImageIDByArchitecture(t *testing.T) {
+	assert.Equal(t, Ec2InstanceType("p3.8xlarge").Architecture(), ArchX86_64)
+	assert.Equal(t, Ec2InstanceType("g5.xlarge").Architecture(), ArchX86_64)
+	assert.Equal(t, Ec2InstanceType("g5g.xlarge").Architecture(), ArchArm64)
+	assert.Equal(t, Ec2InstanceType("c7gn.large").Architecture(), ArchArm64)
+	assert.Equal(t, AWSClusterConfig{InstanceType: "g5g.xlarge"}.Architecture(), ArchArm64)
+
+	imageID, ok := DefaultAWSImageID("us-west-2", ArchX86_64)
+	assert.Assert(t, ok)
+	assert.Equal(t, imageID, defaultAWSImageID["us-west-2"])
+
+	_, ok = DefaultAWSImageID("us-west-2", ArchArm64)
+	assert.Assert(t, !ok)
+}
+
+func TestAWSClusterConfigInstanceSlotsOverrides(t *testing.T) {
+	const instanceType = "p9.48xlarge"
+	parse := func(slots int) AWSClusterConfig {
+		var config AWSClusterConfig
+		err := json.Unmarshal([]byte(fmt.Sprintf(`
+{
+	"ssh_key_name": "test-key",
+	"instance_type": %q,
+	"instance_slots": %d
+}`, instanceType, slots)), &config)
+		assert.NilError(t, err)
+		assert.NilError(t, check.Validate(&config))
+		return config
+	}
+
+	four, eight := parse(4), parse(8)
+	assert.Equal(t, four.SlotsPerInstance(), 4)
+	assert.Equal(t, eight.SlotsPerInstance(), 8)
+	assert.Equal(t, four.EffectiveInstanceType().Slots(), 4)
+	assert.Equal(t, eight.EffectiveInstanceType().Slots(), 8)
+	assert.Equal(t, four.EffectiveInstanceType().Name(), instanceType)
+
+	_, ok := ec2InstanceSlots[instanceType]
+	assert.Assert(t, !ok, "validation should not modify the known instance types")
+}
+
+func TestAWSClusterConfigRootVolume(t *testing.T) {
+	for _, tc := range []struct {
+		json string
+		err  string
+	}{
+		{`{}`, ""},
+		{`{"root_volume_type": "gp3"}`, ""},
+		{`{"root_volume_type": "gp3", "root_volume_iops": 4000, "root_volume_throughput": 250}`, ""},
+		{`{"root_volume_type": "io2", "root_volume_iops": 4000}`, ""},
+		{`{"root_volume_type": "st1"}`, "must be one of gp2, gp3, io1, or io2"},
+		{`{"root_volume_iops": 4000}`, "'root_volume_iops' is not supported for gp2 volumes"},
+		{
+			`{"root_volume_type": "io1", "root_volume_iops": 4000, "root_volume_throughput": 250}`,
+			"'root_volume_throughput' is not supported for io1 volumes",
+		},
+		{`{"root_volume_type": "io2"}`, "'root_volume_iops' is required for io2 volumes"},
+	} {
+		var config AWSClusterConfig
+		assert.NilError(t, json.Unmarshal([]byte(tc.json), &config))
+		config.SSHKeyName = "test-key"
+		err := check.Validate(&config)
+		if tc.err == "" {
+			assert.NilError(t, err, tc.json)
+		} else {
+			assert.ErrorContains(t, err, tc.err, tc.json)
+		}
+	}
+}
+
+func TestAWSClusterConfigSubnets(t *testing.T) {
+	for _, tc := range []struct {
+		json    string
+		subnets []string
+		err     string
+	}{
+		{`{}`, nil, ""},
+		{`{"network_interface": {"subnet_id": "subnet-a"}}`, []string{"subnet-a"}, ""},
+		{
+			`{"network_interface": {"subnet_id": ["subnet-a", "subnet-b"]}}`,
+			[]string{"subnet-a", "subnet-b"}, "",
+		},
+		{
+			`{"network_interface": {"subnet_id": ["subnet-a", "subnet-a"]}}`,
+			nil, "contains subnet subnet-a more than once",
+		},
+		{`{"network_interface": {"subnet_id": ["subnet-a", ""]}}`, nil, "empty subnet IDs"},
+	} {
+		var config AWSClusterConfig
+		assert.NilError(t, json.Unmarshal([]byte(tc.json), &config))
+		config.SSHKeyName = "test-key"
+		err := check.Validate(&config)
+		if tc.err != "" {
+			assert.ErrorContains(t, err, tc.err, tc.json)
+			continue
+		}
+		assert.NilError(t, err, tc.json)
+		assert.DeepEqual(t, config.NetworkInterface.Subnets(), tc.subnets)
+		assert.Assert(t, config.NetworkInterface.PublicIP, "defaults should be kept")
+		if len(tc.subnets) > 0 {
+			assert.Equal(t, config.NetworkInterface.SubnetID, tc.subnets[0])
+		}
+
+		bytes, err := json.Marshal(config.NetworkInterface)
+		assert.NilError(t, err)
+		var roundTripped ec2NetworkInterface
+		assert.NilError(t, json.Unmarshal(bytes, &roundTripped))
+		assert.DeepEqual(t, roundTripped.Subnets(), tc.subnets)
+	}
+
+	var config AWSClusterConfig
+	assert.ErrorContains(t, json.Unmarshal(
+		[]byte(`{"network_interface": {"subnet_id": 1}}`), &config,
+	), "must be a subnet ID or a list of subnet IDs")
+}
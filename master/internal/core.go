@@ -956,6 +956,7 @@ func (m *Master) Run(ctx context.Context) error {
 
 	checkpointsGroup := m.echo.Group("/checkpoints")
 	checkpointsGroup.GET("/:checkpoint_uuid", m.getCheckpoint)
+	checkpointsGroup.HEAD("/:checkpoint_uuid", m.getCheckpoint)
 
 	searcherGroup := m.echo.Group("/searcher")
 	searcherGroup.POST("/preview", api.Route(m.getSearcherPreview))
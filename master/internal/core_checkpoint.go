@@ -4,9 +4,13 @@ import (
 	"bufio"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"path"
+	"strconv"
+	"strings"
 
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
@@ -28,6 +32,14 @@ const (
 	MIMEApplicationGZip = "application/gzip"
 	// MIMEApplicationZip is Zip's MIME type.
 	MIMEApplicationZip = "application/zip"
+
+	headerRange        = "Range"
+	headerAcceptRanges = "Accept-Ranges"
+	headerContentRange = "Content-Range"
+
+	// HEAD requests report the number and total size of the checkpoint files in these headers.
+	headerCheckpointFileCount = "X-Determined-Checkpoint-File-Count"
+	headerCheckpointSize      = "X-Determined-Checkpoint-Size"
 )
 
 func mimeToArchiveType(mimeType string) archive.ArchiveType {
@@ -64,6 +76,94 @@ func newDelayWriter(w io.Writer, delayBytes int) *delayWriter {
 	}
 }
 
+// errRangeNotSatisfiable is returned by parseRange for ranges that start past the end of the body.
+var errRangeNotSatisfiable = errors.New("range not satisfiable")
+
+// byteRange is an inclusive range of bytes of a response body.
+type byteRange struct {
+	start, end int64
+}
+
+// parseRange parses a Range header selecting a single range of a body of the given size, such
+// as "bytes=1024-", "bytes=0-1023", or "bytes=-1024". It returns nil if the header is absent or
+// not a single byte range, in which case the whole body should be sent.
+func parseRange(header string, size int64) (*byteRange, error) {
+	spec := strings.TrimPrefix(header, "bytes=")
+	if spec == header || strings.Contains(spec, ",") {
+		return nil, nil
+	}
+	first, last, ok := strings.Cut(strings.TrimSpace(spec), "-")
+	if !ok {
+		return nil, nil
+	}
+
+	if first == "" {
+		// A suffix range selects the last bytes of the body.
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || n < 0 {
+			return nil, nil
+		}
+		if n == 0 {
+			return nil, errRangeNotSatisfiable
+		}
+		if n > size {
+			n = size
+		}
+		return &byteRange{start: size - n, end: size - 1}, nil
+	}
+
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 {
+		return nil, nil
+	}
+	r := byteRange{start: start, end: size - 1}
+	if last != "" {
+		end, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || end < start {
+			return nil, nil
+		}
+		if end < r.end {
+			r.end = end
+		}
+	}
+	if r.start >= size {
+		return nil, errRangeNotSatisfiable
+	}
+	return &r, nil
+}
+
+// rangeWriter passes on only the bytes written to it that fall within r, or all of them if r is
+// nil. Since checkpoint archives are generated deterministically, regenerating the archive
+// through a rangeWriter serves any range of it.
+type rangeWriter struct {
+	next   io.Writer
+	r      *byteRange
+	offset int64
+}
+
+func (w *rangeWriter) Write(p []byte) (int, error) {
+	offset := w.offset
+	w.offset += int64(len(p))
+	if w.r == nil {
+		return w.next.Write(p)
+	}
+
+	// Clip p, which covers [offset, w.offset) of the body, to the range.
+	lo, hi := int64(0), int64(len(p))
+	if w.r.start > offset {
+		lo = w.r.start - offset
+	}
+	if w.r.end+1 < w.offset {
+		hi = w.r.end + 1 - offset
+	}
+	if lo < hi {
+		if _, err := w.next.Write(p[lo:hi]); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
 func (m *Master) getCheckpointStorageConfig(id uuid.UUID) (
 	*expconf.CheckpointStorageConfig, error,
 ) {
@@ -86,7 +186,13 @@ func (m *Master) getCheckpointStorageConfig(id uuid.UUID) (
 }
 
 func (m *Master) getCheckpointImpl(
-	ctx context.Context, id uuid.UUID, mimeType string, content io.Writer,
+	ctx context.Context,
+	id uuid.UUID,
+	mimeType string,
+	globs []string,
+	rangeHeader string,
+	head bool,
+	resp *echo.Response,
 ) error {
 	// Assume a checkpoint always has experiment configs
 	storageConfig, err := m.getCheckpointStorageConfig(id)
@@ -100,16 +206,74 @@ func (m *Master) getCheckpointImpl(
 			fmt.Sprintf("checkpoint not found: %s", id.String()))
 	}
 
+	if mimeType == echo.MIMEApplicationJSON {
+		return getCheckpointManifest(ctx, id, storageConfig, globs, head, resp)
+	}
+
 	// DelayWriter delays the first write until we have successfully downloaded
 	// some bytes and are more confident that the download will succeed.
-	dw := newDelayWriter(content, 16*1024)
+	rw := &rangeWriter{next: resp}
+	dw := newDelayWriter(rw, 16*1024)
+	var w io.Writer = dw
+	if head {
+		// A HEAD request only lists the checkpoint, so the archive is never sent.
+		w = io.Discard
+	}
 	downloader, err := checkpoints.NewDownloader(
-		dw, id.String(), storageConfig, mimeToArchiveType(mimeType))
+		w, id.String(), storageConfig, mimeToArchiveType(mimeType), globs,
+		m.config.CheckpointDownload.S3Concurrency)
+	if errors.Is(err, checkpoints.ErrUnsupportedStorage) {
+		return echo.NewHTTPError(http.StatusNotImplemented, err.Error())
+	}
 	if err != nil {
 		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 	}
 
+	// Zip downloads are written uncompressed when that makes their size known up front, so that
+	// they carry Content-Length and can be resumed with a Range.
+	size, ok, err := downloader.Size(ctx)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			fmt.Sprintf("unable to download checkpoint %s: %s", id.String(), err.Error()))
+	}
+	if !ok {
+		// Ranges can only be served for archives whose size is known up front.
+		resp.Header().Set(headerAcceptRanges, "none")
+	} else {
+		resp.Header().Set(headerAcceptRanges, "bytes")
+		rw.r, err = parseRange(rangeHeader, size)
+		if errors.Is(err, errRangeNotSatisfiable) {
+			resp.Header().Set(headerContentRange, fmt.Sprintf("bytes */%d", size))
+			return echo.NewHTTPError(http.StatusRequestedRangeNotSatisfiable,
+				fmt.Sprintf("range %q is past the end of the %d byte archive", rangeHeader, size))
+		}
+		// Only a successful download carries the archive size; error responses have their own.
+		// A partial download switches the status to 206 here since echo sets 200 on first write.
+		resp.Before(func() {
+			if resp.Status != http.StatusOK {
+				return
+			}
+			if rw.r == nil {
+				resp.Header().Set(echo.HeaderContentLength, strconv.FormatInt(size, 10))
+				return
+			}
+			resp.Status = http.StatusPartialContent
+			resp.Header().Set(echo.HeaderContentLength,
+				strconv.FormatInt(rw.r.end-rw.r.start+1, 10))
+			resp.Header().Set(headerContentRange,
+				fmt.Sprintf("bytes %d-%d/%d", rw.r.start, rw.r.end, size))
+		})
+	}
+
+	if head {
+		return headCheckpoint(ctx, id, globs, downloader, resp)
+	}
+
 	err = downloader.Download(ctx)
+	if errors.Is(err, checkpoints.ErrNoMatchingFiles) {
+		return echo.NewHTTPError(http.StatusNotFound,
+			fmt.Sprintf("no files in checkpoint %s match %v", id.String(), globs))
+	}
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError,
 			fmt.Sprintf("unable to download checkpoint %s: %s", id.String(), err.Error()))
@@ -127,19 +291,105 @@ func (m *Master) getCheckpointImpl(
 	return nil
 }
 
-//	@Summary	Get a checkpoint's contents in a tgz or zip file.
+// headCheckpoint responds to a HEAD request with the number and total size of the files that
+// downloading the checkpoint would include, along with the headers the download would have.
+func headCheckpoint(
+	ctx context.Context,
+	id uuid.UUID,
+	globs []string,
+	downloader checkpoints.CheckpointDownloader,
+	resp *echo.Response,
+) error {
+	// This reuses the listing Size made, if it made one, rather than listing the checkpoint again.
+	files, err := downloader.Files(ctx)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			fmt.Sprintf("unable to list checkpoint %s: %s", id.String(), err.Error()))
+	}
+	if len(globs) > 0 && len(files) == 0 {
+		return echo.NewHTTPError(http.StatusNotFound,
+			fmt.Sprintf("no files in checkpoint %s match %v", id.String(), globs))
+	}
+	if err := downloader.Close(); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			fmt.Sprintf("failed to list checkpoint: %s", err.Error()))
+	}
+
+	setCheckpointFilesHeaders(files, resp)
+	resp.WriteHeader(http.StatusOK)
+	return nil
+}
+
+// setCheckpointFilesHeaders sets the headers reporting the number and total size of files.
+func setCheckpointFilesHeaders(files []checkpoints.File, resp *echo.Response) {
+	var size int64
+	for _, f := range files {
+		size += f.Size
+	}
+	resp.Header().Set(headerCheckpointFileCount, strconv.Itoa(len(files)))
+	resp.Header().Set(headerCheckpointSize, strconv.FormatInt(size, 10))
+}
+
+// checkpointManifest lists the files of a checkpoint, for clients that accept JSON.
+type checkpointManifest struct {
+	Files []checkpoints.File `json:"files"`
+}
+
+// getCheckpointManifest responds with a manifest of the files that downloading the checkpoint
+// would include, instead of an archive of them.
+func getCheckpointManifest(
+	ctx context.Context,
+	id uuid.UUID,
+	storageConfig *expconf.CheckpointStorageConfig,
+	globs []string,
+	head bool,
+	resp *echo.Response,
+) error {
+	files, err := checkpoints.ListFiles(ctx, id.String(), storageConfig, globs)
+	switch {
+	case errors.Is(err, checkpoints.ErrUnsupportedStorage):
+		return echo.NewHTTPError(http.StatusNotImplemented, err.Error())
+	case errors.Is(err, path.ErrBadPattern):
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	case errors.Is(err, checkpoints.ErrNoMatchingFiles):
+		return echo.NewHTTPError(http.StatusNotFound,
+			fmt.Sprintf("no files in checkpoint %s match %v", id.String(), globs))
+	case err != nil:
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			fmt.Sprintf("unable to list checkpoint %s: %s", id.String(), err.Error()))
+	}
+
+	if head {
+		setCheckpointFilesHeaders(files, resp)
+		resp.WriteHeader(http.StatusOK)
+		return nil
+	}
+	if files == nil {
+		files = []checkpoints.File{}
+	}
+	return json.NewEncoder(resp).Encode(checkpointManifest{Files: files})
+}
+
+//	@Summary	Get a checkpoint's contents in a tgz or zip file, or a JSON manifest of its files.
 //	@Tags		Checkpoints
 //	@ID			get-checkpoint
 //	@Accept		json
-//	@Produce	application/gzip,application/zip
-//	@Param		checkpoint_uuid	path	string	true	"Checkpoint UUID"
+//	@Produce	application/gzip,application/zip,application/json
+//	@Param		checkpoint_uuid	path	string		true	"Checkpoint UUID"
+//	@Param		glob			query	[]string	false	"Only include files matching these globs"	collectionFormat(multi)
+//	@Param		Range			header	string		false	"A single byte range to resume a zip download"
 //	@Success	200				{}		string	""
+//	@Success	206				{}		string	""
+//	@Header		200				{integer}	X-Determined-Checkpoint-File-Count	"Number of files, for HEAD requests"
+//	@Header		200				{integer}	X-Determined-Checkpoint-Size		"Total size of the files, for HEAD requests"
 //	@Router		/checkpoints/{checkpoint_uuid} [get]
+//	@Router		/checkpoints/{checkpoint_uuid} [head]
 func (m *Master) getCheckpoint(c echo.Context) error {
 	// Get the MIME type. Only a single type is accepted.
 	mimeType := c.Request().Header.Get("Accept")
 	if mimeType != MIMEApplicationGZip &&
-		mimeType != MIMEApplicationZip {
+		mimeType != MIMEApplicationZip &&
+		mimeType != echo.MIMEApplicationJSON {
 		return echo.NewHTTPError(http.StatusUnsupportedMediaType,
 			fmt.Sprintf("unsupported media type to download a checkpoint: '%s'", mimeType))
 	}
@@ -175,5 +425,9 @@ func (m *Master) getCheckpoint(c echo.Context) error {
 	}
 
 	c.Response().Header().Set(echo.HeaderContentType, mimeType)
-	return m.getCheckpointImpl(c.Request().Context(), id, mimeType, c.Response())
+	// A file is included if its path, or the path of one of its parent directories, matches
+	// any of the globs. No globs selects the whole checkpoint.
+	globs := c.QueryParams()["glob"]
+	return m.getCheckpointImpl(c.Request().Context(), id, mimeType, globs,
+		c.Request().Header.Get(headerRange), c.Request().Method == http.MethodHead, c.Response())
 }
@@ -8,15 +8,19 @@ import (
 	"archive/zip"
 	"compress/gzip"
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
 
+	"cloud.google.com/go/storage"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
@@ -37,8 +41,10 @@ import (
 )
 
 const (
-	S3TestBucket = "storage-unit-tests"
-	S3TestPrefix = "master/checkpoint-download"
+	S3TestBucket  = "storage-unit-tests"
+	S3TestPrefix  = "master/checkpoint-download"
+	GCSTestBucket = "storage-unit-tests"
+	GCSTestPrefix = "master/checkpoint-download"
 )
 
 var mockCheckpointContent = map[string]string{
@@ -87,7 +93,45 @@ func createMockCheckpointS3(bucket string, prefix string) error {
 	return nil
 }
 
-func checkTgz(t *testing.T, content io.Reader, id string) {
+// mockCheckpointLibContent is the subset of mockCheckpointContent selected by the "lib" glob.
+var mockCheckpointLibContent = map[string]string{
+	"lib/big-data.txt": mockCheckpointContent["lib/big-data.txt"],
+	"lib/math.py":      mockCheckpointContent["lib/math.py"],
+}
+
+func createMockCheckpointGCS(bucket string, prefix string) error {
+	ctx := context.TODO()
+	client, err := storage.NewClient(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = client.Close()
+	}()
+
+	for k, v := range mockCheckpointContent {
+		w := client.Bucket(bucket).Object(prefix + "/" + k).NewWriter(ctx)
+		if _, err := io.Copy(w, strings.NewReader(v)); err != nil {
+			_ = w.Close()
+			return err
+		}
+		if err := w.Close(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func createMockCheckpointSharedFS(t *testing.T, dir string) {
+	for k, v := range mockCheckpointContent {
+		path := filepath.Join(dir, k)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o700))
+		require.NoError(t, os.WriteFile(path, []byte(v), 0o600))
+	}
+}
+
+func checkTgz(t *testing.T, content io.Reader, id string, want map[string]string) {
 	zr, err := gzip.NewReader(content)
 	require.NoError(t, err, "failed to create a gzip reader")
 	tr := tar.NewReader(zr)
@@ -105,10 +149,10 @@ func checkTgz(t *testing.T, content io.Reader, id string) {
 		}
 		gotMap[hdr.Name] = buf.String()
 	}
-	require.Equal(t, mockCheckpointContent, gotMap)
+	require.Equal(t, want, gotMap)
 }
 
-func checkZip(t *testing.T, content string, id string) {
+func checkZip(t *testing.T, content string, id string, want map[string]string) {
 	zr, err := zip.NewReader(strings.NewReader(content), int64(len(content)))
 	require.NoError(t, err, "failed to create a zip reader")
 	gotMap := make(map[string]string)
@@ -121,14 +165,20 @@ func checkZip(t *testing.T, content string, id string) {
 		require.NoError(t, rc.Close())
 		gotMap[f.Name] = buf.String()
 	}
-	require.Equal(t, mockCheckpointContent, gotMap)
+	require.Equal(t, want, gotMap)
 }
 
 func addMockCheckpointDB(t *testing.T, pgDB *db.PgDB, id uuid.UUID) {
+	addMockCheckpointDBWithStorage(t, pgDB, id, mockS3StorageConfig())
+}
+
+func addMockCheckpointDBWithStorage(
+	t *testing.T, pgDB *db.PgDB, id uuid.UUID, storage *expconf.CheckpointStorageConfigV0,
+) {
 	require.NoError(t, etc.SetRootPath(db.RootFromDB))
 	user := db.RequireMockUser(t, pgDB)
 	// Using a different path than DefaultTestSrcPath since we are one level up than most db tests
-	exp := mockExperimentS3(t, pgDB, user, "../../examples/tutorials/mnist_pytorch")
+	exp := mockExperiment(t, pgDB, user, "../../examples/tutorials/mnist_pytorch", storage)
 	tr := db.RequireMockTrial(t, pgDB, exp)
 	allocation := db.RequireMockAllocation(t, pgDB, tr.TaskID)
 	// Create checkpoints
@@ -144,6 +194,13 @@ func createCheckpoint(t *testing.T, pgDB *db.PgDB) (string, error) {
 	return id.String(), err
 }
 
+func createCheckpointGCS(t *testing.T, pgDB *db.PgDB) (string, error) {
+	id := uuid.New()
+	addMockCheckpointDBWithStorage(t, pgDB, id, mockGCSStorageConfig())
+	err := createMockCheckpointGCS(GCSTestBucket, GCSTestPrefix+"/"+id.String())
+	return id.String(), err
+}
+
 func setupCheckpointTestEcho(t *testing.T) (
 	*apiServer, echo.Context, *httptest.ResponseRecorder,
 ) {
@@ -183,7 +240,8 @@ func TestGetCheckpointEcho(t *testing.T) {
 			ctx.Request().Header.Set("Accept", MIMEApplicationGZip)
 			err = api.m.getCheckpoint(ctx)
 			require.NoError(t, err, "API call returns error")
-			checkTgz(t, rec.Body, id)
+			require.Empty(t, rec.Header().Get(echo.HeaderContentLength))
+			checkTgz(t, rec.Body, id, mockCheckpointContent)
 			return err
 		}, []any{mock.Anything, mock.Anything, mock.Anything}},
 		{"CanGetCheckpointZip", func(id string) error {
@@ -198,9 +256,91 @@ func TestGetCheckpointEcho(t *testing.T) {
 			ctx.Request().Header.Set("Accept", MIMEApplicationZip)
 			err = api.m.getCheckpoint(ctx)
 			require.NoError(t, err, "API call returns error")
-			checkZip(t, rec.Body.String(), id)
+			checkZip(t, rec.Body.String(), id, mockCheckpointContent)
+			require.Equal(t, strconv.Itoa(rec.Body.Len()), rec.Header().Get(echo.HeaderContentLength))
+			require.Equal(t, "bytes", rec.Header().Get("Accept-Ranges"))
+			return err
+		}, []any{mock.Anything, mock.Anything, mock.Anything}},
+		{"CanGetCheckpointZipRange", func(id string) error {
+			api, ctx, rec := setupCheckpointTestEcho(t)
+			id, err := createCheckpoint(t, api.m.db)
+			if err != nil {
+				return err
+			}
+			ctx.SetParamNames("checkpoint_uuid")
+			ctx.SetParamValues(id)
+			ctx.SetRequest(httptest.NewRequest(http.MethodGet, "/", nil))
+			ctx.Request().Header.Set("Accept", MIMEApplicationZip)
+			ctx.Request().Header.Set("Range", "bytes=0-")
+			require.NoError(t, api.m.getCheckpoint(ctx), "API call returns error")
+			full := rec.Body.String()
+			require.Equal(t, http.StatusPartialContent, rec.Code)
+			require.Equal(t, strconv.Itoa(len(full)), rec.Header().Get(echo.HeaderContentLength))
+			checkZip(t, full, id, mockCheckpointContent)
+
+			// Resuming from the middle returns the rest of the same archive.
+			api, ctx, rec = setupCheckpointTestEcho(t)
+			ctx.SetParamNames("checkpoint_uuid")
+			ctx.SetParamValues(id)
+			ctx.SetRequest(httptest.NewRequest(http.MethodGet, "/", nil))
+			ctx.Request().Header.Set("Accept", MIMEApplicationZip)
+			ctx.Request().Header.Set("Range", "bytes=1000-")
+			require.NoError(t, api.m.getCheckpoint(ctx), "API call returns error")
+			require.Equal(t, http.StatusPartialContent, rec.Code)
+			require.Equal(t, "bytes", rec.Header().Get("Accept-Ranges"))
+			require.Equal(t, fmt.Sprintf("bytes 1000-%d/%d", len(full)-1, len(full)),
+				rec.Header().Get("Content-Range"))
+			require.Equal(t, full[1000:], rec.Body.String())
+			return nil
+		}, []any{mock.Anything, mock.Anything, mock.Anything}},
+		{"CanGetCheckpointTgzFiltered", func(id string) error {
+			api, ctx, rec := setupCheckpointTestEcho(t)
+			id, err := createCheckpoint(t, api.m.db)
+			if err != nil {
+				return err
+			}
+			ctx.SetParamNames("checkpoint_uuid")
+			ctx.SetParamValues(id)
+			ctx.SetRequest(httptest.NewRequest(http.MethodGet, "/?glob=lib", nil))
+			ctx.Request().Header.Set("Accept", MIMEApplicationGZip)
+			err = api.m.getCheckpoint(ctx)
+			require.NoError(t, err, "API call returns error")
+			checkTgz(t, rec.Body, id, mockCheckpointLibContent)
+			return err
+		}, []any{mock.Anything, mock.Anything, mock.Anything}},
+		{"CanGetCheckpointZipFiltered", func(id string) error {
+			api, ctx, rec := setupCheckpointTestEcho(t)
+			id, err := createCheckpoint(t, api.m.db)
+			if err != nil {
+				return err
+			}
+			ctx.SetParamNames("checkpoint_uuid")
+			ctx.SetParamValues(id)
+			ctx.SetRequest(httptest.NewRequest(http.MethodGet, "/?glob=lib/*.py&glob=data.txt", nil))
+			ctx.Request().Header.Set("Accept", MIMEApplicationZip)
+			err = api.m.getCheckpoint(ctx)
+			require.NoError(t, err, "API call returns error")
+			checkZip(t, rec.Body.String(), id, map[string]string{
+				"data.txt":    mockCheckpointContent["data.txt"],
+				"lib/math.py": mockCheckpointContent["lib/math.py"],
+			})
 			return err
 		}, []any{mock.Anything, mock.Anything, mock.Anything}},
+		{"CanGetCheckpointFilteredNoMatch", func(id string) error {
+			api, ctx, _ := setupCheckpointTestEcho(t)
+			id, err := createCheckpoint(t, api.m.db)
+			if err != nil {
+				return err
+			}
+			ctx.SetParamNames("checkpoint_uuid")
+			ctx.SetParamValues(id)
+			ctx.SetRequest(httptest.NewRequest(http.MethodGet, "/?glob=*.ckpt", nil))
+			ctx.Request().Header.Set("Accept", MIMEApplicationZip)
+			err = api.m.getCheckpoint(ctx)
+			require.Equal(t, echo.NewHTTPError(http.StatusNotFound,
+				fmt.Sprintf("no files in checkpoint %s match [*.ckpt]", id)), err)
+			return nil
+		}, []any{mock.Anything, mock.Anything, mock.Anything}},
 	}
 
 	for _, curCase := range cases {
@@ -208,6 +348,144 @@ func TestGetCheckpointEcho(t *testing.T) {
 	}
 }
 
+func TestGetCheckpointEchoGCS(t *testing.T) {
+	gitBranch := os.Getenv("CIRCLE_BRANCH")
+	if gitBranch == "" || strings.HasPrefix(gitBranch, "pull/") {
+		t.Skipf("skipping test %s in a forked repo (branch: %s) due to lack of credentials",
+			t.Name(), gitBranch)
+	}
+	var id string
+	cases := []struct {
+		DenyFuncName string
+		IDToReqCall  func(id string) error
+		Params       []any
+	}{
+		{"CanGetCheckpointTgz", func(id string) error {
+			api, ctx, rec := setupCheckpointTestEcho(t)
+			id, err := createCheckpointGCS(t, api.m.db)
+			if err != nil {
+				return err
+			}
+			ctx.SetParamNames("checkpoint_uuid")
+			ctx.SetParamValues(id)
+			ctx.SetRequest(httptest.NewRequest(http.MethodGet, "/", nil))
+			ctx.Request().Header.Set("Accept", MIMEApplicationGZip)
+			err = api.m.getCheckpoint(ctx)
+			require.NoError(t, err, "API call returns error")
+			require.Empty(t, rec.Header().Get(echo.HeaderContentLength))
+			checkTgz(t, rec.Body, id, mockCheckpointContent)
+			return err
+		}, []any{mock.Anything, mock.Anything, mock.Anything}},
+		{"CanGetCheckpointZip", func(id string) error {
+			api, ctx, rec := setupCheckpointTestEcho(t)
+			id, err := createCheckpointGCS(t, api.m.db)
+			if err != nil {
+				return err
+			}
+			ctx.SetParamNames("checkpoint_uuid")
+			ctx.SetParamValues(id)
+			ctx.SetRequest(httptest.NewRequest(http.MethodGet, "/", nil))
+			ctx.Request().Header.Set("Accept", MIMEApplicationZip)
+			err = api.m.getCheckpoint(ctx)
+			require.NoError(t, err, "API call returns error")
+			checkZip(t, rec.Body.String(), id, mockCheckpointContent)
+			require.Equal(t, strconv.Itoa(rec.Body.Len()), rec.Header().Get(echo.HeaderContentLength))
+			require.Equal(t, "bytes", rec.Header().Get("Accept-Ranges"))
+			return err
+		}, []any{mock.Anything, mock.Anything, mock.Anything}},
+	}
+
+	for _, curCase := range cases {
+		require.NoError(t, curCase.IDToReqCall(id))
+	}
+}
+
+func TestGetCheckpointEchoSharedFS(t *testing.T) {
+	api, ctx, rec := setupCheckpointTestEcho(t)
+	hostPath := t.TempDir()
+	id := uuid.New()
+	addMockCheckpointDBWithStorage(t, api.m.db, id, mockSharedFSStorageConfig(hostPath))
+	createMockCheckpointSharedFS(t, filepath.Join(hostPath, id.String()))
+
+	ctx.SetParamNames("checkpoint_uuid")
+	ctx.SetParamValues(id.String())
+	ctx.SetRequest(httptest.NewRequest(http.MethodGet, "/", nil))
+	ctx.Request().Header.Set("Accept", MIMEApplicationGZip)
+	require.NoError(t, api.m.getCheckpoint(ctx), "API call returns error")
+	checkTgz(t, rec.Body, id.String(), mockCheckpointContent)
+
+	// A HEAD request reports the number and total size of the files without downloading them.
+	api, ctx, rec = setupCheckpointTestEcho(t)
+	ctx.SetParamNames("checkpoint_uuid")
+	ctx.SetParamValues(id.String())
+	ctx.SetRequest(httptest.NewRequest(http.MethodHead, "/", nil))
+	ctx.Request().Header.Set("Accept", MIMEApplicationZip)
+	require.NoError(t, api.m.getCheckpoint(ctx), "API call returns error")
+	var size int
+	for _, v := range mockCheckpointContent {
+		size += len(v)
+	}
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, strconv.Itoa(len(mockCheckpointContent)),
+		rec.Header().Get("X-Determined-Checkpoint-File-Count"))
+	require.Equal(t, strconv.Itoa(size), rec.Header().Get("X-Determined-Checkpoint-Size"))
+	require.NotEmpty(t, rec.Header().Get(echo.HeaderContentLength))
+	require.Zero(t, rec.Body.Len())
+}
+
+func TestGetCheckpointEchoManifest(t *testing.T) {
+	hostPath := t.TempDir()
+	id := uuid.New()
+	api, _, _ := setupCheckpointTestEcho(t)
+	addMockCheckpointDBWithStorage(t, api.m.db, id, mockSharedFSStorageConfig(hostPath))
+	createMockCheckpointSharedFS(t, filepath.Join(hostPath, id.String()))
+
+	getManifest := func(target string) (map[string]int64, error) {
+		api, ctx, rec := setupCheckpointTestEcho(t)
+		ctx.SetParamNames("checkpoint_uuid")
+		ctx.SetParamValues(id.String())
+		ctx.SetRequest(httptest.NewRequest(http.MethodGet, target, nil))
+		ctx.Request().Header.Set("Accept", echo.MIMEApplicationJSON)
+		if err := api.m.getCheckpoint(ctx); err != nil {
+			return nil, err
+		}
+		require.Equal(t, http.StatusOK, rec.Code)
+		require.Equal(t, echo.MIMEApplicationJSON, rec.Header().Get(echo.HeaderContentType))
+
+		var manifest struct {
+			Files []struct {
+				Path string `json:"path"`
+				Size int64  `json:"size"`
+			} `json:"files"`
+		}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &manifest))
+		sizes := make(map[string]int64)
+		for _, f := range manifest.Files {
+			sizes[f.Path] = f.Size
+		}
+		return sizes, nil
+	}
+	contentSizes := func(content map[string]string) map[string]int64 {
+		sizes := make(map[string]int64)
+		for k, v := range content {
+			sizes[k] = int64(len(v))
+		}
+		return sizes
+	}
+
+	sizes, err := getManifest("/")
+	require.NoError(t, err)
+	require.Equal(t, contentSizes(mockCheckpointContent), sizes)
+
+	sizes, err = getManifest("/?glob=lib")
+	require.NoError(t, err)
+	require.Equal(t, contentSizes(mockCheckpointLibContent), sizes)
+
+	_, err = getManifest("/?glob=*.ckpt")
+	require.Equal(t, echo.NewHTTPError(http.StatusNotFound,
+		fmt.Sprintf("no files in checkpoint %s match [*.ckpt]", id)), err)
+}
+
 // TestGetCheckpointEchoExpErr expects specific errors are returned for each check.
 func TestGetCheckpointEchoExpErr(t *testing.T) {
 	cases := []struct {
@@ -249,6 +527,20 @@ func TestGetCheckpointEchoExpErr(t *testing.T) {
 	}
 }
 
+func TestGetCheckpointEchoUnsupportedStorage(t *testing.T) {
+	api, ctx, _ := setupCheckpointTestEcho(t)
+	id := uuid.New()
+	addMockCheckpointDBWithStorage(t, api.m.db, id, mockHDFSStorageConfig())
+
+	ctx.SetParamNames("checkpoint_uuid")
+	ctx.SetParamValues(id.String())
+	ctx.SetRequest(httptest.NewRequest(http.MethodGet, "/", nil))
+	ctx.Request().Header.Set("Accept", MIMEApplicationZip)
+	require.Equal(t, echo.NewHTTPError(http.StatusNotImplemented,
+		"checkpoint download via master is not supported for hdfs backend"),
+		api.m.getCheckpoint(ctx))
+}
+
 func TestAuthZCheckpointsEcho(t *testing.T) {
 	api, authZExp, _, curUser, _ := setupExpAuthTest(t, nil)
 	ctx := newTestEchoContext(curUser)
@@ -264,6 +556,10 @@ func TestAuthZCheckpointsEcho(t *testing.T) {
 	// Not found same as permission denied.
 	require.Equal(t, echo.NewHTTPError(http.StatusNotFound,
 		fmt.Sprintf("checkpoint not found: %s", checkpointUUID)), api.m.getCheckpoint(ctx))
+	ctx.Request().Method = http.MethodHead
+	require.Equal(t, echo.NewHTTPError(http.StatusNotFound,
+		fmt.Sprintf("checkpoint not found: %s", checkpointUUID)), api.m.getCheckpoint(ctx))
+	ctx.Request().Method = http.MethodGet
 
 	addMockCheckpointDB(t, api.m.db, checkpointUUID)
 
@@ -284,16 +580,51 @@ func TestAuthZCheckpointsEcho(t *testing.T) {
 }
 
 //nolint: exhaustivestruct
-func mockExperimentS3(
+func mockS3StorageConfig() *expconf.CheckpointStorageConfigV0 {
+	return &expconf.CheckpointStorageConfigV0{
+		RawS3Config: &expconf.S3ConfigV0{
+			RawBucket: aws.String(S3TestBucket),
+			RawPrefix: aws.String(S3TestPrefix),
+		},
+	}
+}
+
+//nolint: exhaustivestruct
+func mockGCSStorageConfig() *expconf.CheckpointStorageConfigV0 {
+	return &expconf.CheckpointStorageConfigV0{
+		RawGCSConfig: &expconf.GCSConfigV0{
+			RawBucket: aws.String(GCSTestBucket),
+			RawPrefix: aws.String(GCSTestPrefix),
+		},
+	}
+}
+
+//nolint: exhaustivestruct
+func mockSharedFSStorageConfig(hostPath string) *expconf.CheckpointStorageConfigV0 {
+	return &expconf.CheckpointStorageConfigV0{
+		RawSharedFSConfig: &expconf.SharedFSConfigV0{
+			RawHostPath: ptrs.Ptr(hostPath),
+		},
+	}
+}
+
+//nolint: exhaustivestruct
+func mockHDFSStorageConfig() *expconf.CheckpointStorageConfigV0 {
+	return &expconf.CheckpointStorageConfigV0{
+		RawHDFSConfig: &expconf.HDFSConfigV0{
+			RawURL:  ptrs.Ptr("hdfs://localhost:9000"),
+			RawPath: ptrs.Ptr("/checkpoints"),
+		},
+	}
+}
+
+//nolint: exhaustivestruct
+func mockExperiment(
 	t *testing.T, pgDB *db.PgDB, user model.User, folderPath string,
+	storage *expconf.CheckpointStorageConfigV0,
 ) *model.Experiment {
 	cfg := schemas.WithDefaults(expconf.ExperimentConfigV0{
-		RawCheckpointStorage: &expconf.CheckpointStorageConfigV0{
-			RawS3Config: &expconf.S3ConfigV0{
-				RawBucket: aws.String(S3TestBucket),
-				RawPrefix: aws.String(S3TestPrefix),
-			},
-		},
+		RawCheckpointStorage: storage,
 		RawEntrypoint: &expconf.EntrypointV0{
 			RawEntrypoint: ptrs.Ptr("model.Classifier"),
 		},
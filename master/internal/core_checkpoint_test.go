@@ -0,0 +1,58 @@
+package internal
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRange(t *testing.T) {
+	const size = 100
+	cases := []struct {
+		header string
+		want   *byteRange
+		err    error
+	}{
+		{"", nil, nil},
+		{"bytes=10-", &byteRange{10, 99}, nil},
+		{"bytes=10-19", &byteRange{10, 19}, nil},
+		{"bytes=10-1000", &byteRange{10, 99}, nil},
+		{"bytes=-30", &byteRange{70, 99}, nil},
+		{"bytes=-1000", &byteRange{0, 99}, nil},
+		{"bytes=100-", nil, errRangeNotSatisfiable},
+		{"bytes=-0", nil, errRangeNotSatisfiable},
+		{"bytes=0-9,20-29", nil, nil},
+		{"bytes=20-10", nil, nil},
+		{"bytes=abc-", nil, nil},
+		{"items=0-9", nil, nil},
+	}
+	for _, c := range cases {
+		got, err := parseRange(c.header, size)
+		require.Equal(t, c.err, err, c.header)
+		require.Equal(t, c.want, got, c.header)
+	}
+}
+
+func TestRangeWriter(t *testing.T) {
+	body := []byte("0123456789abcdefghij")
+	for _, r := range []*byteRange{nil, {0, 19}, {5, 19}, {5, 12}, {19, 19}} {
+		var buf bytes.Buffer
+		w := &rangeWriter{next: &buf, r: r}
+		// Write in uneven chunks so that the range starts and ends mid-chunk.
+		for i := 0; i < len(body); i += 3 {
+			end := i + 3
+			if end > len(body) {
+				end = len(body)
+			}
+			n, err := w.Write(body[i:end])
+			require.NoError(t, err)
+			require.Equal(t, end-i, n)
+		}
+		want := body
+		if r != nil {
+			want = body[r.start : r.end+1]
+		}
+		require.Equal(t, string(want), buf.String())
+	}
+}
@@ -6,12 +6,17 @@ import (
 	"encoding/pem"
 	"fmt"
 	"net/url"
+	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ssm"
 	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
 
 	"github.com/determined-ai/determined/master/internal/config/provconfig"
 	"github.com/determined-ai/determined/master/pkg/actor"
@@ -27,6 +32,15 @@ type awsCluster struct {
 	masterURL    url.URL
 	ec2UserData  []byte
 	client       *ec2.EC2
+	ssmClient    ssmParameterGetter
+
+	// The index of the configured subnet that instances are launched in. It moves on to the next
+	// subnet when EC2 reports insufficient capacity in the current one.
+	subnetIndex int
+
+	// The AMIs that passed validateImage, so that images resolved again at launch are only
+	// validated when they change.
+	validImageIDs map[string]bool
 
 	// State that is only used if spot instances are enabled
 	spot *spotState
@@ -51,10 +65,21 @@ func newAWSCluster(
 	//    "ec2:TerminateInstances",
 	//    "ec2:CreateTags",
 	//    "ec2:RunInstances".
+	//    If a launch template is configured, the following permission will be required
+	//    "ec2:DescribeLaunchTemplateVersions".
+	//    The following permission is used to validate the AMI, and is required if allowed AMI
+	//    owners are configured
+	//    "ec2:DescribeImages".
 	//    If using spot instances, the following permissions will be required
 	//    "ec2:CancelSpotInstanceRequests",
 	//    "ec2:RequestSpotInstances",
 	//    "ec2:DescribeSpotInstanceRequests",
+	//    Spot settings are checked at startup with a dry run of "ec2:RunInstances" for a spot
+	//    instance, which needs no additional permissions.
+	//    If a subnet is configured, the following permission is used to validate it
+	//    "ec2:DescribeSubnets".
+	//    If the image ID refers to an SSM parameter, the following permission will be required
+	//    "ssm:GetParameter".
 	// 2. Use a shared credentials file
 	//    In order to be able to connect to AWS, the credentials should be put in the
 	//    file `~/.aws/credential` in the format:
@@ -98,6 +123,7 @@ func newAWSCluster(
 		AWSClusterConfig: config.AWS,
 		masterURL:        *masterURL,
 		client:           ec2.New(sess),
+		ssmClient:        ssm.New(sess),
 		ec2UserData: mustMakeAgentSetupScript(agentSetupScriptConfig{
 			MasterHost:                   masterURL.Hostname(),
 			MasterPort:                   masterURL.Port(),
@@ -119,19 +145,315 @@ func newAWSCluster(
 		}),
 	}
 
+	imageID, err := cluster.resolveImageID(log.WithField("resource-pool", resourcePool))
+	if err != nil {
+		return nil, err
+	}
+	if cluster.LaunchTemplateID != "" {
+		templateImageID, err := launchTemplateImageID(
+			cluster.client, cluster.LaunchTemplateID, cluster.LaunchTemplateVersion)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case imageID == "":
+			imageID = templateImageID
+		case templateImageID != "" && templateImageID != imageID && !cluster.LaunchTemplateOverride:
+			return nil, errors.Errorf(
+				"ec2 image %s conflicts with image %s of launch template %s; "+
+					"set launch_template_override to use the configured image",
+				imageID, templateImageID, cluster.LaunchTemplateID)
+		}
+	}
+	if err := cluster.validateImage(cluster.client, imageID); err != nil {
+		return nil, err
+	}
+	if err := validateSubnets(cluster.client, cluster.NetworkInterface.Subnets()); err != nil {
+		return nil, err
+	}
+	if cluster.SpotEnabled {
+		if err := validateSpotDryRun(cluster.client, cluster.spotDryRunInput(imageID)); err != nil {
+			return nil, err
+		}
+	}
+
 	if cluster.SpotEnabled {
 		cluster.spot = &spotState{
-			trackedReqs:          newSetOfSpotRequests(),
-			approximateClockSkew: time.Second * 0,
-			launchTimeOffset:     time.Second * 10,
+			trackedReqs:              newSetOfSpotRequests(),
+			capacityNotAvailableReqs: newSetOfStrings(),
+			approximateClockSkew:     time.Second * 0,
+			launchTimeOffset:         time.Second * 10,
 		}
 	}
 
 	return cluster, nil
 }
 
+// ec2LaunchTemplateDescriber is the subset of the EC2 API used to look up launch templates.
+type ec2LaunchTemplateDescriber interface {
+	DescribeLaunchTemplateVersions(
+		*ec2.DescribeLaunchTemplateVersionsInput,
+	) (*ec2.DescribeLaunchTemplateVersionsOutput, error)
+}
+
+// launchTemplateImageID returns the AMI ID pinned by the launch template version, or an empty
+// string if the template doesn't specify one. An empty version refers to the default version.
+func launchTemplateImageID(
+	client ec2LaunchTemplateDescriber, templateID, version string,
+) (string, error) {
+	if version == "" {
+		version = "$Default"
+	}
+	output, err := client.DescribeLaunchTemplateVersions(&ec2.DescribeLaunchTemplateVersionsInput{
+		LaunchTemplateId: aws.String(templateID),
+		Versions:         []*string{aws.String(version)},
+	})
+	if err != nil {
+		return "", errors.Wrapf(err, "cannot describe EC2 launch template %s", templateID)
+	}
+	if len(output.LaunchTemplateVersions) == 0 {
+		return "", errors.Errorf(
+			"cannot find version %s of EC2 launch template %s", version, templateID)
+	}
+	data := output.LaunchTemplateVersions[0].LaunchTemplateData
+	if data == nil {
+		return "", nil
+	}
+	return aws.StringValue(data.ImageId), nil
+}
+
+// ssmParameterGetter is the subset of the SSM API used to resolve image IDs from SSM parameters.
+type ssmParameterGetter interface {
+	GetParameter(*ssm.GetParameterInput) (*ssm.GetParameterOutput, error)
+}
+
+// resolveSSMImageID returns the AMI ID held by the SSM parameter that the image ID refers to, or
+// the image ID itself if it doesn't refer to an SSM parameter.
+func resolveSSMImageID(client ssmParameterGetter, imageID string) (string, error) {
+	if !strings.HasPrefix(imageID, provconfig.SSMImageIDPrefix) {
+		return imageID, nil
+	}
+
+	name := strings.TrimPrefix(imageID, provconfig.SSMImageIDPrefix)
+	output, err := client.GetParameter(&ssm.GetParameterInput{Name: aws.String(name)})
+	if err != nil {
+		return "", errors.Wrapf(err, "cannot resolve image ID from SSM parameter %s", name)
+	}
+	if output.Parameter == nil || aws.StringValue(output.Parameter.Value) == "" {
+		return "", errors.Errorf("SSM parameter %s does not contain an image ID", name)
+	}
+	return *output.Parameter.Value, nil
+}
+
+// resolveImageID returns the AMI ID to launch instances from. Image IDs that refer to an SSM
+// parameter are resolved on every call so that new instances always use the latest AMI; if that
+// fails, the default AMI for the region is used instead.
+func (c *awsCluster) resolveImageID(logger *log.Entry) (string, error) {
+	imageID, err := resolveSSMImageID(c.ssmClient, c.ImageID)
+	if err == nil {
+		return imageID, nil
+	}
+	fallback, ok := provconfig.DefaultAWSImageID(c.Region, c.Architecture())
+	if !ok {
+		return "", err
+	}
+	logger.WithError(err).Errorf("falling back to the default image ID %s", fallback)
+	return fallback, nil
+}
+
+// launchImageID resolves the AMI ID to launch instances from and validates it.
+func (c *awsCluster) launchImageID(logger *log.Entry) (string, error) {
+	imageID, err := c.resolveImageID(logger)
+	if err != nil {
+		return "", err
+	}
+	if err := c.validateImage(c.client, imageID); err != nil {
+		return "", err
+	}
+	return imageID, nil
+}
+
+// validateImage checks the owner and root volume size of the AMI, unless it has already passed
+// these checks. An empty image ID leaves the image to the launch template.
+func (c *awsCluster) validateImage(client ec2ImageDescriber, imageID string) error {
+	if imageID == "" || c.validImageIDs[imageID] {
+		return nil
+	}
+	// The AMI is described once for both checks, and not at all if neither applies.
+	if len(c.AllowedAMIOwners) > 0 || c.RootVolumeSize != 0 {
+		image, err := describeImage(client, imageID)
+		if err != nil && len(c.AllowedAMIOwners) > 0 {
+			return err
+		}
+		if err := validateImageOwner(image, imageID, c.AllowedAMIOwners); err != nil {
+			return err
+		}
+		if image == nil && c.RootVolumeSize != 0 {
+			// Failing to look up the AMI is only fatal for the owner check, since the master may
+			// not have access to the EC2 API (e.g., when it is not running on EC2).
+			log.WithError(err).Warnf(
+				"cannot look up the root volume size required by EC2 image %s", imageID)
+		}
+		if err := validateImageRootVolumeSize(image, imageID, c.RootVolumeSize); err != nil {
+			return err
+		}
+	}
+	if c.validImageIDs == nil {
+		c.validImageIDs = make(map[string]bool)
+	}
+	c.validImageIDs[imageID] = true
+	return nil
+}
+
+// ec2ImageDescriber is the subset of the EC2 API used to look up AMI metadata.
+type ec2ImageDescriber interface {
+	DescribeImages(*ec2.DescribeImagesInput) (*ec2.DescribeImagesOutput, error)
+}
+
+// describeImage returns the metadata of the AMI, or nil if it cannot be found.
+func describeImage(client ec2ImageDescriber, imageID string) (*ec2.Image, error) {
+	output, err := client.DescribeImages(&ec2.DescribeImagesInput{
+		ImageIds: []*string{aws.String(imageID)},
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot describe EC2 image %s", imageID)
+	}
+	if len(output.Images) == 0 {
+		return nil, nil
+	}
+	return output.Images[0], nil
+}
+
+// validateImageOwner checks that the owner of the AMI is in the list of allowed owners. No check is
+// done if the list of allowed owners is empty.
+func validateImageOwner(image *ec2.Image, imageID string, allowedOwners []string) error {
+	if len(allowedOwners) == 0 {
+		return nil
+	}
+	if image == nil || image.OwnerId == nil {
+		return errors.Errorf("cannot find the owner of EC2 image %s", imageID)
+	}
+
+	// Owners may be allowed by account ID or by alias, such as "amazon".
+	owner := *image.OwnerId
+	alias := aws.StringValue(image.ImageOwnerAlias)
+	for _, allowed := range allowedOwners {
+		if owner == allowed || (alias != "" && alias == allowed) {
+			return nil
+		}
+	}
+	return errors.Errorf(
+		"EC2 image %s is owned by %s, which is not one of the allowed AMI owners: %s",
+		imageID, owner, strings.Join(allowedOwners, ", "),
+	)
+}
+
+// validateImageRootVolumeSize checks that the root volume is at least as large as the root device
+// snapshot of the AMI. There is nothing to check if the AMI could not be looked up, or if the size
+// is zero, which leaves the root volume to the launch template.
+func validateImageRootVolumeSize(image *ec2.Image, imageID string, rootVolumeSize int) error {
+	if image == nil || rootVolumeSize == 0 {
+		return nil
+	}
+
+	for _, mapping := range image.BlockDeviceMappings {
+		if aws.StringValue(mapping.DeviceName) != aws.StringValue(image.RootDeviceName) ||
+			mapping.Ebs == nil || mapping.Ebs.VolumeSize == nil {
+			continue
+		}
+		if required := int(*mapping.Ebs.VolumeSize); rootVolumeSize < required {
+			return errors.Errorf(
+				"ec2 root volume size must be >= %d, the size of the root snapshot of image %s",
+				required, imageID)
+		}
+	}
+	return nil
+}
+
+// ec2SubnetDescriber is the subset of the EC2 API used to look up subnets.
+type ec2SubnetDescriber interface {
+	DescribeSubnets(*ec2.DescribeSubnetsInput) (*ec2.DescribeSubnetsOutput, error)
+}
+
+// validateSubnets checks that the configured subnets exist and are all in the same VPC. Failing to
+// call the EC2 API is not fatal, since the master may not have the permission to describe subnets.
+func validateSubnets(client ec2SubnetDescriber, subnetIDs []string) error {
+	if len(subnetIDs) == 0 {
+		return nil
+	}
+
+	output, err := client.DescribeSubnets(&ec2.DescribeSubnetsInput{
+		SubnetIds: aws.StringSlice(subnetIDs),
+	})
+	if awsErr, ok := err.(awserr.Error); ok && awsErr.Code() == "InvalidSubnetID.NotFound" {
+		return errors.Errorf("cannot find EC2 subnets: %s", awsErr.Message())
+	}
+	if err != nil {
+		log.WithError(err).Warnf("cannot look up EC2 subnets %s", strings.Join(subnetIDs, ", "))
+		return nil
+	}
+
+	vpcs := map[string]bool{}
+	found := map[string]bool{}
+	for _, subnet := range output.Subnets {
+		found[aws.StringValue(subnet.SubnetId)] = true
+		vpcs[aws.StringValue(subnet.VpcId)] = true
+	}
+	for _, subnetID := range subnetIDs {
+		if !found[subnetID] {
+			return errors.Errorf("cannot find EC2 subnet %s", subnetID)
+		}
+	}
+	if len(vpcs) > 1 {
+		return errors.Errorf("EC2 subnets %s must all be in the same VPC",
+			strings.Join(subnetIDs, ", "))
+	}
+	return nil
+}
+
+// ec2InstanceRunner is the subset of the EC2 API used to launch instances.
+type ec2InstanceRunner interface {
+	RunInstances(*ec2.RunInstancesInput) (*ec2.Reservation, error)
+}
+
+// validateSpotDryRun makes a dry run launch of a spot instance, so that a bad instance type,
+// subnet, or spot setting is reported at startup instead of as capacity errors when scaling up.
+// The check is skipped if the master cannot reach the EC2 API or has no credentials for it.
+func validateSpotDryRun(client ec2InstanceRunner, input *ec2.RunInstancesInput) error {
+	_, err := client.RunInstances(input)
+	if err == nil {
+		return nil
+	}
+	awsErr, ok := err.(awserr.Error)
+	switch {
+	case ok && awsErr.Code() == "DryRunOperation":
+		return nil
+	case !ok, awsErr.Code() == "NoCredentialProviders", awsErr.Code() == request.ErrCodeRequestError:
+		log.WithError(err).Warn("skipping the dry run launch of a spot instance")
+		return nil
+	default:
+		return errors.Errorf("dry run launch of a spot instance failed: %s: %s",
+			awsErr.Code(), awsErr.Message())
+	}
+}
+
+// spotDryRunInput returns the input to launch a single spot instance with the configured
+// instance type, network, and spot settings as a dry run.
+func (c *awsCluster) spotDryRunInput(imageID string) *ec2.RunInstancesInput {
+	input := c.runInstancesInput(imageID, 1, true)
+	spotOptions := &ec2.SpotMarketOptions{}
+	if c.SpotMaxPrice != provconfig.SpotPriceNotSetPlaceholder {
+		spotOptions.MaxPrice = aws.String(c.SpotMaxPrice)
+	}
+	input.InstanceMarketOptions = &ec2.InstanceMarketOptionsRequest{
+		MarketType:  aws.String(ec2.MarketTypeSpot),
+		SpotOptions: spotOptions,
+	}
+	return input
+}
+
 func (c *awsCluster) instanceType() model.InstanceType {
-	return c.InstanceType
+	return c.EffectiveInstanceType()
 }
 
 func (c *awsCluster) slotsPerInstance() int {
@@ -159,6 +481,11 @@ func (c *awsCluster) stateFromEC2State(state *ec2.InstanceState) model.InstanceS
 }
 
 func (c *awsCluster) prestart(ctx *actor.Context) {
+	if slots := c.instanceType().Slots(); c.CPUSlotsAllowed && slots > 0 {
+		ctx.Log().Warnf(
+			"ec2 'cpu_slots_allowed' has no effect for instance type %s, which has %d GPU slots",
+			c.InstanceType.Name(), slots)
+	}
 	if c.SpotEnabled {
 		c.attemptToApproximateClockSkew(ctx)
 		c.cleanupLegacySpotInstances(ctx)
@@ -215,7 +542,7 @@ func (c *awsCluster) launchOnDemand(ctx *actor.Context, instanceNum int) {
 	if instanceNum <= 0 {
 		return
 	}
-	instances, err := c.launchInstances(instanceNum, false)
+	instances, err := c.launchInstances(ctx, instanceNum, false)
 	if err != nil {
 		ctx.Log().WithError(err).Error("cannot launch EC2 instances")
 		return
@@ -333,23 +660,98 @@ func (c *awsCluster) describeInstancesByID(
 	return instances, nil
 }
 
-func (c *awsCluster) launchInstances(instanceNum int, dryRun bool) (*ec2.Reservation, error) {
-	input := &ec2.RunInstancesInput{
-		BlockDeviceMappings: []*ec2.BlockDeviceMapping{
-			{
-				DeviceName: aws.String("/dev/sda1"),
-				Ebs: &ec2.EbsBlockDevice{
-					DeleteOnTermination: aws.Bool(true),
-					VolumeSize:          aws.Int64(int64(c.RootVolumeSize)),
-					VolumeType:          aws.String("gp2"),
-				},
-			},
+func (c *awsCluster) launchInstances(
+	ctx *actor.Context, instanceNum int, dryRun bool,
+) (*ec2.Reservation, error) {
+	imageID, err := c.launchImageID(ctx.Log())
+	if err != nil {
+		return nil, err
+	}
+	return c.runInstances(c.client, imageID, instanceNum, dryRun)
+}
+
+// runInstances launches instances in the current subnet. If EC2 doesn't have enough capacity in
+// it, each of the other configured subnets is tried once, and the one that succeeds is used for
+// later launches too.
+func (c *awsCluster) runInstances(
+	client ec2InstanceRunner, imageID string, instanceNum int, dryRun bool,
+) (*ec2.Reservation, error) {
+	numSubnets := len(c.NetworkInterface.Subnets())
+	for attempt := 1; ; attempt++ {
+		reservation, err := client.RunInstances(c.runInstancesInput(imageID, instanceNum, dryRun))
+		if !isInsufficientCapacityError(err) || attempt >= numSubnets {
+			return reservation, err
+		}
+		failedSubnet := c.subnetID()
+		c.nextSubnet()
+		log.WithError(err).Warnf("EC2 subnet %s has insufficient capacity, trying subnet %s",
+			failedSubnet, c.subnetID())
+	}
+}
+
+// subnetID returns the subnet to launch instances in, or an empty string if none is configured.
+func (c *awsCluster) subnetID() string {
+	subnets := c.NetworkInterface.Subnets()
+	if len(subnets) == 0 {
+		return ""
+	}
+	return subnets[c.subnetIndex%len(subnets)]
+}
+
+// nextSubnet moves on to the next configured subnet, wrapping around after the last one.
+func (c *awsCluster) nextSubnet() {
+	if subnets := c.NetworkInterface.Subnets(); len(subnets) > 0 {
+		c.subnetIndex = (c.subnetIndex + 1) % len(subnets)
+	}
+}
+
+func isInsufficientCapacityError(err error) bool {
+	awsErr, ok := err.(awserr.Error)
+	return ok && awsErr.Code() == "InsufficientInstanceCapacity"
+}
+
+// rootBlockDeviceMappings returns the agent root volume mapping for on-demand and spot launches.
+// It is nil when none of the root volume fields are configured, which is only possible with a
+// launch template, so that instances keep the template's root volume.
+func (c *awsCluster) rootBlockDeviceMappings() []*ec2.BlockDeviceMapping {
+	if c.RootVolumeSize == 0 && c.RootVolumeType == "" &&
+		c.RootVolumeIOPS == nil && c.RootVolumeThroughput == nil {
+		return nil
+	}
+	ebs := &ec2.EbsBlockDevice{
+		DeleteOnTermination: aws.Bool(true),
+	}
+	if c.RootVolumeSize != 0 {
+		ebs.VolumeSize = aws.Int64(int64(c.RootVolumeSize))
+	}
+	if c.RootVolumeType != "" {
+		ebs.VolumeType = aws.String(c.RootVolumeType)
+	}
+	if c.RootVolumeIOPS != nil {
+		ebs.Iops = aws.Int64(int64(*c.RootVolumeIOPS))
+	}
+	if c.RootVolumeThroughput != nil {
+		ebs.Throughput = aws.Int64(int64(*c.RootVolumeThroughput))
+	}
+	return []*ec2.BlockDeviceMapping{
+		{
+			DeviceName: aws.String("/dev/sda1"),
+			Ebs:        ebs,
 		},
+	}
+}
+
+// runInstancesInput builds the request to launch instances. If a launch template is configured, it
+// is used as the base of the request and only the fields managed by Determined and the fields that
+// are explicitly configured are layered on top of it.
+func (c *awsCluster) runInstancesInput(
+	imageID string, instanceNum int, dryRun bool,
+) *ec2.RunInstancesInput {
+	input := &ec2.RunInstancesInput{
+		BlockDeviceMappings:               c.rootBlockDeviceMappings(),
 		DryRun:                            aws.Bool(dryRun),
-		ImageId:                           aws.String(c.ImageID),
 		InstanceInitiatedShutdownBehavior: aws.String(ec2.ShutdownBehaviorTerminate),
 		InstanceType:                      aws.String(c.AWSClusterConfig.InstanceType.Name()),
-		KeyName:                           aws.String(c.SSHKeyName),
 		MaxCount:                          aws.Int64(int64(instanceNum)),
 		MinCount:                          aws.Int64(1),
 		TagSpecifications: []*ec2.TagSpecification{
@@ -385,6 +787,21 @@ func (c *awsCluster) launchInstances(instanceNum int, dryRun bool) (*ec2.Reserva
 		UserData: aws.String(base64.StdEncoding.EncodeToString(c.ec2UserData)),
 	}
 
+	if c.LaunchTemplateID != "" {
+		input.LaunchTemplate = &ec2.LaunchTemplateSpecification{
+			LaunchTemplateId: aws.String(c.LaunchTemplateID),
+		}
+		if c.LaunchTemplateVersion != "" {
+			input.LaunchTemplate.Version = aws.String(c.LaunchTemplateVersion)
+		}
+	}
+	if imageID != "" {
+		input.ImageId = aws.String(imageID)
+	}
+	if c.SSHKeyName != "" {
+		input.KeyName = aws.String(c.SSHKeyName)
+	}
+
 	if c.CustomTags != nil {
 		for _, tag := range c.CustomTags {
 			customTag := &ec2.Tag{
@@ -395,20 +812,24 @@ func (c *awsCluster) launchInstances(instanceNum int, dryRun bool) (*ec2.Reserva
 		}
 	}
 
-	input.NetworkInterfaces = []*ec2.InstanceNetworkInterfaceSpecification{
-		{
-			AssociatePublicIpAddress: aws.Bool(c.NetworkInterface.PublicIP),
-			DeleteOnTermination:      aws.Bool(true),
-			Description:              aws.String("network interface created by Determined"),
-			DeviceIndex:              aws.Int64(0),
-		},
-	}
-	if c.NetworkInterface.SubnetID != "" {
-		input.NetworkInterfaces[0].SubnetId = aws.String(c.NetworkInterface.SubnetID)
-	}
-	if c.NetworkInterface.SecurityGroupID != "" {
-		input.NetworkInterfaces[0].Groups = []*string{
-			aws.String(c.NetworkInterface.SecurityGroupID),
+	// Leave the network interface to the launch template unless one is explicitly configured.
+	if c.LaunchTemplateID == "" || c.subnetID() != "" ||
+		c.NetworkInterface.SecurityGroupID != "" {
+		input.NetworkInterfaces = []*ec2.InstanceNetworkInterfaceSpecification{
+			{
+				AssociatePublicIpAddress: aws.Bool(c.NetworkInterface.PublicIP),
+				DeleteOnTermination:      aws.Bool(true),
+				Description:              aws.String("network interface created by Determined"),
+				DeviceIndex:              aws.Int64(0),
+			},
+		}
+		if subnetID := c.subnetID(); subnetID != "" {
+			input.NetworkInterfaces[0].SubnetId = aws.String(subnetID)
+		}
+		if c.NetworkInterface.SecurityGroupID != "" {
+			input.NetworkInterfaces[0].Groups = []*string{
+				aws.String(c.NetworkInterface.SecurityGroupID),
+			}
 		}
 	}
 
@@ -418,7 +839,7 @@ func (c *awsCluster) launchInstances(instanceNum int, dryRun bool) (*ec2.Reserva
 		}
 	}
 
-	return c.client.RunInstances(input)
+	return input
 }
 
 func (c *awsCluster) terminateInstances(
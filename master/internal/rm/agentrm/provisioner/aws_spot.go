@@ -108,6 +108,26 @@ type spotState struct {
 	// far in the future and AWS won't try to fulfill it until that time is reached. This is
 	// why the approximateClockSkew measurement is needed.
 	launchTimeOffset time.Duration
+
+	// The IDs of the active requests that have reported capacity-not-available, so that the
+	// subnet is rotated once when requests fail rather than on every provisioner tick.
+	capacityNotAvailableReqs setOfStrings
+}
+
+// newCapacityNotAvailable records which of the active requests report capacity-not-available
+// and returns true if any of them had not reported it before.
+func (s *spotState) newCapacityNotAvailable(activeReqs *setOfSpotRequests) bool {
+	reqs := newSetOfStrings()
+	isNew := false
+	for _, req := range activeReqs.iter() {
+		if req.StatusCode == nil || *req.StatusCode != "capacity-not-available" {
+			continue
+		}
+		reqs.add(req.SpotRequestID)
+		isNew = isNew || !s.capacityNotAvailableReqs.contains(req.SpotRequestID)
+	}
+	s.capacityNotAvailableReqs = reqs
+	return isNew
 }
 
 // listSpot lists all unfulfilled and fulfilled spot requests. If the spot request has been
@@ -144,6 +164,13 @@ func (c *awsCluster) listSpot(ctx *actor.Context) ([]*model.Instance, error) {
 			reqsToNotifyUserAbout.add(req)
 		}
 	}
+	// Launch new spot requests in the next subnet, which may be in an availability zone that has
+	// capacity.
+	if c.spot.newCapacityNotAvailable(activeReqsInAPI) && len(c.NetworkInterface.Subnets()) > 1 {
+		c.nextSubnet()
+		ctx.Log().Infof("spot capacity is not available, launching spot requests in subnet %s",
+			c.subnetID())
+	}
 
 	// If there are requests that we are tracking, but didn't get returned
 	// in listActiveSpotInstanceRequests, query the API for them specifically.
@@ -496,6 +523,10 @@ func (c *awsCluster) createSpotInstanceRequestsCorrectingForClockSkew(
 					"launchOffset to %s to correct for clock skew",
 					c.spot.launchTimeOffset.String())
 			}
+			if isInsufficientCapacityError(err) {
+				c.nextSubnet()
+				ctx.Log().Infof("retrying spot instances in subnet %s", c.subnetID())
+			}
 		} else {
 			ctx.Log().Errorf("unknown error while launch spot instances, %s", err.Error())
 			return nil, err
@@ -514,6 +545,10 @@ func (c *awsCluster) createSpotInstanceRequest(
 	if dryRun {
 		ctx.Log().Debug("dry run of createSpotInstanceRequest.")
 	}
+	imageID, err := c.launchImageID(ctx.Log())
+	if err != nil {
+		return nil, err
+	}
 	idempotencyToken := uuid.New().String()
 
 	validFrom := time.Now().UTC().Add(c.spot.approximateClockSkew).Add(launchTimeOffset)
@@ -523,19 +558,10 @@ func (c *awsCluster) createSpotInstanceRequest(
 		InstanceCount:                aws.Int64(int64(numInstances)),
 		InstanceInterruptionBehavior: aws.String("terminate"),
 		LaunchSpecification: &ec2.RequestSpotLaunchSpecification{
-			BlockDeviceMappings: []*ec2.BlockDeviceMapping{
-				{
-					DeviceName: aws.String("/dev/sda1"),
-					Ebs: &ec2.EbsBlockDevice{
-						DeleteOnTermination: aws.Bool(true),
-						VolumeSize:          aws.Int64(int64(c.RootVolumeSize)),
-						VolumeType:          aws.String("gp2"),
-					},
-				},
-			},
-			ImageId:      aws.String(c.ImageID),
-			InstanceType: aws.String(instanceType.Name()),
-			KeyName:      aws.String(c.SSHKeyName),
+			BlockDeviceMappings: c.rootBlockDeviceMappings(),
+			ImageId:             aws.String(imageID),
+			InstanceType:        aws.String(instanceType.Name()),
+			KeyName:             aws.String(c.SSHKeyName),
 
 			UserData: aws.String(base64.StdEncoding.EncodeToString(c.ec2UserData)),
 		},
@@ -578,9 +604,8 @@ func (c *awsCluster) createSpotInstanceRequest(
 			DeviceIndex:              aws.Int64(0),
 		},
 	}
-	if c.NetworkInterface.SubnetID != "" {
-		subnet := aws.String(c.NetworkInterface.SubnetID)
-		spotInput.LaunchSpecification.NetworkInterfaces[0].SubnetId = subnet
+	if subnetID := c.subnetID(); subnetID != "" {
+		spotInput.LaunchSpecification.NetworkInterfaces[0].SubnetId = aws.String(subnetID)
 	}
 	if c.NetworkInterface.SecurityGroupID != "" {
 		spotInput.LaunchSpecification.NetworkInterfaces[0].Groups = []*string{
@@ -131,6 +131,11 @@ func (c *setOfStrings) add(s string) {
 	c.keyMap[s] = true
 }
 
+// contains returns true if the string is in the set.
+func (c *setOfStrings) contains(s string) bool {
+	return c.keyMap[s]
+}
+
 // length returns the number of items in the set.
 func (c *setOfStrings) length() int {
 	return len(c.keyMap)
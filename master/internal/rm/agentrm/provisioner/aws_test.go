@@ -0,0 +1,471 @@
+package provisioner
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"gotest.tools/assert"
+
+	"github.com/determined-ai/determined/master/internal/config/provconfig"
+)
+
+type mockImageDescriber struct {
+	images map[string]*ec2.Image
+	err    error
+	calls  int
+}
+
+func (m *mockImageDescriber) DescribeImages(
+	input *ec2.DescribeImagesInput,
+) (*ec2.DescribeImagesOutput, error) {
+	m.calls++
+	if m.err != nil {
+		return nil, m.err
+	}
+	var images []*ec2.Image
+	for _, id := range input.ImageIds {
+		if image, ok := m.images[*id]; ok {
+			images = append(images, image)
+		}
+	}
+	return &ec2.DescribeImagesOutput{Images: images}, nil
+}
+
+func TestValidateImageOwner(t *testing.T) {
+	trusted := &ec2.Image{OwnerId: aws.String("123456789012")}
+	untrusted := &ec2.Image{OwnerId: aws.String("999999999999")}
+	amazon := &ec2.Image{
+		OwnerId:         aws.String("137112412989"),
+		ImageOwnerAlias: aws.String("amazon"),
+	}
+	allowed := []string{"123456789012", "amazon"}
+
+	assert.NilError(t, validateImageOwner(trusted, "ami-trusted", allowed))
+	assert.ErrorContains(t, validateImageOwner(untrusted, "ami-untrusted", allowed),
+		"owned by 999999999999, which is not one of the allowed AMI owners")
+	assert.ErrorContains(t, validateImageOwner(nil, "ami-missing", allowed),
+		"cannot find the owner")
+	assert.NilError(t, validateImageOwner(untrusted, "ami-untrusted", nil))
+
+	// An allowlist of only aliases matches the image owner alias.
+	assert.NilError(t, validateImageOwner(amazon, "ami-amazon", []string{"amazon"}))
+	assert.ErrorContains(t, validateImageOwner(trusted, "ami-trusted", []string{"amazon"}),
+		"owned by 123456789012")
+}
+
+func TestValidateImageRootVolumeSize(t *testing.T) {
+	image := &ec2.Image{
+		RootDeviceName: aws.String("/dev/sda1"),
+		BlockDeviceMappings: []*ec2.BlockDeviceMapping{
+			{
+				DeviceName: aws.String("/dev/sda1"),
+				Ebs:        &ec2.EbsBlockDevice{VolumeSize: aws.Int64(300)},
+			},
+			{
+				DeviceName: aws.String("/dev/sdb"),
+				Ebs:        &ec2.EbsBlockDevice{VolumeSize: aws.Int64(1000)},
+			},
+		},
+	}
+
+	assert.NilError(t, validateImageRootVolumeSize(image, "ami-large", 300))
+	assert.ErrorContains(t, validateImageRootVolumeSize(image, "ami-large", 200),
+		"ec2 root volume size must be >= 300")
+	assert.NilError(t, validateImageRootVolumeSize(nil, "ami-missing", 100))
+	assert.NilError(t, validateImageRootVolumeSize(image, "ami-large", 0))
+}
+
+func TestValidateImage(t *testing.T) {
+	describer := &mockImageDescriber{images: map[string]*ec2.Image{
+		"ami-large": {
+			OwnerId:        aws.String("123456789012"),
+			RootDeviceName: aws.String("/dev/sda1"),
+			BlockDeviceMappings: []*ec2.BlockDeviceMapping{
+				{
+					DeviceName: aws.String("/dev/sda1"),
+					Ebs:        &ec2.EbsBlockDevice{VolumeSize: aws.Int64(300)},
+				},
+			},
+		},
+	}}
+	cluster := &awsCluster{AWSClusterConfig: &provconfig.AWSClusterConfig{
+		RootVolumeSize:   300,
+		AllowedAMIOwners: []string{"123456789012"},
+	}}
+
+	// Both checks share a single description of the image.
+	assert.NilError(t, cluster.validateImage(describer, "ami-large"))
+	assert.Equal(t, describer.calls, 1)
+
+	cluster = &awsCluster{AWSClusterConfig: &provconfig.AWSClusterConfig{RootVolumeSize: 200}}
+	assert.ErrorContains(t, cluster.validateImage(describer, "ami-large"),
+		"ec2 root volume size must be >= 300")
+
+	// Failing to describe the image only fails the owner check.
+	describer.err = errors.New("no EC2 credentials")
+	assert.NilError(t, cluster.validateImage(describer, "ami-large"))
+	cluster.AllowedAMIOwners = []string{"123456789012"}
+	assert.ErrorContains(t, cluster.validateImage(describer, "ami-other"),
+		"cannot describe EC2 image ami-other")
+
+	// Neither check applies, so the image is not described.
+	cluster = &awsCluster{AWSClusterConfig: &provconfig.AWSClusterConfig{}}
+	calls := describer.calls
+	assert.NilError(t, cluster.validateImage(describer, "ami-large"))
+	assert.Equal(t, describer.calls, calls)
+}
+
+type mockSSMClient struct {
+	parameters map[string]string
+}
+
+func (m *mockSSMClient) GetParameter(
+	input *ssm.GetParameterInput,
+) (*ssm.GetParameterOutput, error) {
+	value, ok := m.parameters[*input.Name]
+	if !ok {
+		return nil, errors.Errorf("parameter %s not found", *input.Name)
+	}
+	return &ssm.GetParameterOutput{
+		Parameter: &ssm.Parameter{Name: input.Name, Value: aws.String(value)},
+	}, nil
+}
+
+func TestResolveImageID(t *testing.T) {
+	const parameter = "/aws/service/determined/agent/image_id"
+	client := &mockSSMClient{parameters: map[string]string{parameter: "ami-latest"}}
+
+	imageID, err := resolveSSMImageID(client, "ami-static")
+	assert.NilError(t, err)
+	assert.Equal(t, imageID, "ami-static")
+
+	imageID, err = resolveSSMImageID(client, provconfig.SSMImageIDPrefix+parameter)
+	assert.NilError(t, err)
+	assert.Equal(t, imageID, "ami-latest")
+
+	_, err = resolveSSMImageID(client, provconfig.SSMImageIDPrefix+"/missing")
+	assert.ErrorContains(t, err, "cannot resolve image ID from SSM parameter /missing")
+
+	defaultImageID, ok := provconfig.DefaultAWSImageID("us-west-2", provconfig.ArchX86_64)
+	assert.Assert(t, ok)
+	cluster := &awsCluster{
+		AWSClusterConfig: &provconfig.AWSClusterConfig{
+			Region:       "us-west-2",
+			ImageID:      provconfig.SSMImageIDPrefix + "/missing",
+			InstanceType: "p3.2xlarge",
+		},
+		ssmClient: client,
+	}
+	logger := log.NewEntry(log.StandardLogger())
+	imageID, err = cluster.resolveImageID(logger)
+	assert.NilError(t, err)
+	assert.Equal(t, imageID, defaultImageID)
+
+	cluster.Region = "nowhere-1"
+	_, err = cluster.resolveImageID(logger)
+	assert.ErrorContains(t, err, "/missing")
+}
+
+func TestValidateResolvedImage(t *testing.T) {
+	const parameter = "/aws/service/determined/agent/image_id"
+	client := &mockSSMClient{parameters: map[string]string{parameter: "ami-trusted"}}
+	describer := &mockImageDescriber{images: map[string]*ec2.Image{
+		"ami-trusted":   {OwnerId: aws.String("123456789012")},
+		"ami-untrusted": {OwnerId: aws.String("999999999999")},
+	}}
+	cluster := &awsCluster{
+		AWSClusterConfig: &provconfig.AWSClusterConfig{
+			Region:           "us-west-2",
+			ImageID:          provconfig.SSMImageIDPrefix + parameter,
+			InstanceType:     "p3.2xlarge",
+			AllowedAMIOwners: []string{"123456789012"},
+		},
+		ssmClient: client,
+	}
+	logger := log.NewEntry(log.StandardLogger())
+
+	imageID, err := cluster.resolveImageID(logger)
+	assert.NilError(t, err)
+	assert.NilError(t, cluster.validateImage(describer, imageID))
+	calls := describer.calls
+	assert.NilError(t, cluster.validateImage(describer, imageID))
+	assert.Equal(t, describer.calls, calls, "a validated image should not be checked again")
+
+	// The SSM parameter now points to an AMI from an owner that is not allowed.
+	client.parameters[parameter] = "ami-untrusted"
+	imageID, err = cluster.resolveImageID(logger)
+	assert.NilError(t, err)
+	assert.ErrorContains(t, cluster.validateImage(describer, imageID),
+		"owned by 999999999999, which is not one of the allowed AMI owners")
+	assert.ErrorContains(t, cluster.validateImage(describer, imageID),
+		"owned by 999999999999")
+}
+
+type mockLaunchTemplateDescriber struct {
+	imageIDs map[string]string
+}
+
+func (m *mockLaunchTemplateDescriber) DescribeLaunchTemplateVersions(
+	input *ec2.DescribeLaunchTemplateVersionsInput,
+) (*ec2.DescribeLaunchTemplateVersionsOutput, error) {
+	key := *input.LaunchTemplateId + "/" + *input.Versions[0]
+	imageID, ok := m.imageIDs[key]
+	if !ok {
+		return &ec2.DescribeLaunchTemplateVersionsOutput{}, nil
+	}
+	return &ec2.DescribeLaunchTemplateVersionsOutput{
+		LaunchTemplateVersions: []*ec2.LaunchTemplateVersion{
+			{LaunchTemplateData: &ec2.ResponseLaunchTemplateData{ImageId: aws.String(imageID)}},
+		},
+	}, nil
+}
+
+func TestLaunchTemplateImageID(t *testing.T) {
+	client := &mockLaunchTemplateDescriber{imageIDs: map[string]string{
+		"lt-123/$Default": "ami-default",
+		"lt-123/3":        "ami-v3",
+	}}
+
+	imageID, err := launchTemplateImageID(client, "lt-123", "")
+	assert.NilError(t, err)
+	assert.Equal(t, imageID, "ami-default")
+
+	imageID, err = launchTemplateImageID(client, "lt-123", "3")
+	assert.NilError(t, err)
+	assert.Equal(t, imageID, "ami-v3")
+
+	_, err = launchTemplateImageID(client, "lt-123", "4")
+	assert.ErrorContains(t, err, "cannot find version 4 of EC2 launch template lt-123")
+}
+
+func TestRunInstancesInputWithLaunchTemplate(t *testing.T) {
+	cluster := &awsCluster{
+		AWSClusterConfig: &provconfig.AWSClusterConfig{
+			InstanceType:          "p3.2xlarge",
+			LaunchTemplateID:      "lt-123",
+			LaunchTemplateVersion: "3",
+		},
+		resourcePool: "default",
+	}
+
+	input := cluster.runInstancesInput("", 2, false)
+	assert.Equal(t, *input.LaunchTemplate.LaunchTemplateId, "lt-123")
+	assert.Equal(t, *input.LaunchTemplate.Version, "3")
+	assert.Assert(t, input.ImageId == nil)
+	assert.Assert(t, input.KeyName == nil)
+	assert.Assert(t, input.NetworkInterfaces == nil)
+	assert.Equal(t, *input.InstanceType, "p3.2xlarge")
+	assert.Equal(t, *input.MaxCount, int64(2))
+	assert.Assert(t, input.UserData != nil)
+	assert.Assert(t, input.BlockDeviceMappings == nil)
+
+	cluster.RootVolumeSize = 300
+	input = cluster.runInstancesInput("", 2, false)
+	assert.Equal(t, *input.BlockDeviceMappings[0].Ebs.VolumeSize, int64(300))
+	assert.Assert(t, input.BlockDeviceMappings[0].Ebs.VolumeType == nil)
+
+	cluster.SSHKeyName = "key"
+	cluster.NetworkInterface.SubnetID = "subnet-123"
+	input = cluster.runInstancesInput("ami-123", 2, false)
+	assert.Equal(t, *input.ImageId, "ami-123")
+	assert.Equal(t, *input.KeyName, "key")
+	assert.Equal(t, *input.NetworkInterfaces[0].SubnetId, "subnet-123")
+}
+
+func TestRootBlockDeviceMappings(t *testing.T) {
+	cluster := &awsCluster{
+		AWSClusterConfig: &provconfig.AWSClusterConfig{
+			RootVolumeSize: 200,
+			RootVolumeType: "gp2",
+		},
+	}
+	ebs := cluster.rootBlockDeviceMappings()[0].Ebs
+	assert.Equal(t, *ebs.VolumeType, "gp2")
+	assert.Equal(t, *ebs.VolumeSize, int64(200))
+	assert.Assert(t, ebs.Iops == nil)
+	assert.Assert(t, ebs.Throughput == nil)
+
+	iops, throughput := 6000, 500
+	cluster.RootVolumeType = "gp3"
+	cluster.RootVolumeIOPS = &iops
+	cluster.RootVolumeThroughput = &throughput
+	ebs = cluster.rootBlockDeviceMappings()[0].Ebs
+	assert.Equal(t, *ebs.VolumeType, "gp3")
+	assert.Equal(t, *ebs.Iops, int64(6000))
+	assert.Equal(t, *ebs.Throughput, int64(500))
+}
+
+type mockInstanceRunner struct {
+	err   error
+	input *ec2.RunInstancesInput
+}
+
+func (m *mockInstanceRunner) RunInstances(
+	input *ec2.RunInstancesInput,
+) (*ec2.Reservation, error) {
+	m.input = input
+	return nil, m.err
+}
+
+func TestValidateSpotDryRun(t *testing.T) {
+	cluster := &awsCluster{
+		AWSClusterConfig: &provconfig.AWSClusterConfig{
+			InstanceType:   "p3.2xlarge",
+			RootVolumeSize: 200,
+			RootVolumeType: "gp2",
+			SpotEnabled:    true,
+			SpotMaxPrice:   provconfig.SpotPriceNotSetPlaceholder,
+		},
+		resourcePool: "default",
+	}
+	input := cluster.spotDryRunInput("ami-123")
+	assert.Assert(t, *input.DryRun)
+	assert.Equal(t, *input.MaxCount, int64(1))
+	assert.Equal(t, *input.InstanceMarketOptions.MarketType, ec2.MarketTypeSpot)
+	assert.Assert(t, input.InstanceMarketOptions.SpotOptions.MaxPrice == nil)
+
+	cluster.SpotMaxPrice = "0.50"
+	input = cluster.spotDryRunInput("ami-123")
+	assert.Equal(t, *input.InstanceMarketOptions.SpotOptions.MaxPrice, "0.50")
+
+	runner := &mockInstanceRunner{
+		err: awserr.New("DryRunOperation", "Request would have succeeded.", nil),
+	}
+	assert.NilError(t, validateSpotDryRun(runner, input))
+	assert.Equal(t, runner.input, input)
+
+	runner.err = awserr.New("InvalidParameterCombination",
+		"The instance type p3.2xlarge is not supported for spot instances.", nil)
+	assert.ErrorContains(t, validateSpotDryRun(runner, input),
+		"The instance type p3.2xlarge is not supported for spot instances.")
+
+	runner.err = awserr.New("NoCredentialProviders", "no valid providers in chain", nil)
+	assert.NilError(t, validateSpotDryRun(runner, input))
+	runner.err = awserr.New(request.ErrCodeRequestError, "send request failed", nil)
+	assert.NilError(t, validateSpotDryRun(runner, input))
+	runner.err = errors.New("connection refused")
+	assert.NilError(t, validateSpotDryRun(runner, input))
+}
+
+type mockCapacityRunner struct {
+	fullSubnets map[string]bool
+	tried       []string
+}
+
+func (m *mockCapacityRunner) RunInstances(
+	input *ec2.RunInstancesInput,
+) (*ec2.Reservation, error) {
+	subnetID := *input.NetworkInterfaces[0].SubnetId
+	m.tried = append(m.tried, subnetID)
+	if m.fullSubnets[subnetID] {
+		return nil, awserr.New("InsufficientInstanceCapacity", "no capacity", nil)
+	}
+	return &ec2.Reservation{}, nil
+}
+
+func TestRunInstancesAcrossSubnets(t *testing.T) {
+	cluster := &awsCluster{
+		AWSClusterConfig: &provconfig.AWSClusterConfig{
+			InstanceType:   "p3.2xlarge",
+			RootVolumeSize: 200,
+			RootVolumeType: "gp2",
+		},
+		resourcePool: "default",
+	}
+	cluster.NetworkInterface.SubnetID = "subnet-a"
+	cluster.NetworkInterface.SubnetIDs = []string{"subnet-a", "subnet-b", "subnet-c"}
+
+	runner := &mockCapacityRunner{fullSubnets: map[string]bool{"subnet-a": true}}
+	_, err := cluster.runInstances(runner, "ami-123", 1, false)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, runner.tried, []string{"subnet-a", "subnet-b"})
+
+	runner = &mockCapacityRunner{fullSubnets: map[string]bool{}}
+	_, err = cluster.runInstances(runner, "ami-123", 1, false)
+	assert.NilError(t, err)
+	// The subnet that had capacity is kept for later launches.
+	assert.DeepEqual(t, runner.tried, []string{"subnet-b"})
+
+	runner = &mockCapacityRunner{fullSubnets: map[string]bool{
+		"subnet-a": true, "subnet-b": true, "subnet-c": true,
+	}}
+	_, err = cluster.runInstances(runner, "ami-123", 1, false)
+	assert.Assert(t, isInsufficientCapacityError(err))
+	assert.DeepEqual(t, runner.tried, []string{"subnet-b", "subnet-c", "subnet-a"})
+}
+
+type mockSubnetDescriber struct {
+	vpcs map[string]string
+	err  error
+}
+
+func (m *mockSubnetDescriber) DescribeSubnets(
+	input *ec2.DescribeSubnetsInput,
+) (*ec2.DescribeSubnetsOutput, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	var subnets []*ec2.Subnet
+	for _, id := range input.SubnetIds {
+		if vpc, ok := m.vpcs[*id]; ok {
+			subnets = append(subnets, &ec2.Subnet{SubnetId: id, VpcId: aws.String(vpc)})
+		}
+	}
+	return &ec2.DescribeSubnetsOutput{Subnets: subnets}, nil
+}
+
+func TestValidateSubnets(t *testing.T) {
+	describer := &mockSubnetDescriber{vpcs: map[string]string{
+		"subnet-a": "vpc-1",
+		"subnet-b": "vpc-1",
+		"subnet-c": "vpc-2",
+	}}
+
+	assert.NilError(t, validateSubnets(describer, nil))
+	assert.NilError(t, validateSubnets(describer, []string{"subnet-a", "subnet-b"}))
+	assert.ErrorContains(t, validateSubnets(describer, []string{"subnet-a", "subnet-c"}),
+		"must all be in the same VPC")
+	assert.ErrorContains(t, validateSubnets(describer, []string{"subnet-a", "subnet-d"}),
+		"cannot find EC2 subnet subnet-d")
+
+	describer.err = awserr.New("InvalidSubnetID.NotFound",
+		"The subnet ID 'subnet-d' does not exist", nil)
+	assert.ErrorContains(t, validateSubnets(describer, []string{"subnet-d"}),
+		"The subnet ID 'subnet-d' does not exist")
+	describer.err = awserr.New("UnauthorizedOperation", "not authorized", nil)
+	assert.NilError(t, validateSubnets(describer, []string{"subnet-d"}))
+}
+
+func TestNewCapacityNotAvailable(t *testing.T) {
+	reqs := func(statusCodes map[string]string) *setOfSpotRequests {
+		set := newSetOfSpotRequests()
+		for id, code := range statusCodes {
+			set.add(&spotRequest{SpotRequestID: id, StatusCode: aws.String(code)})
+		}
+		return &set
+	}
+	state := &spotState{capacityNotAvailableReqs: newSetOfStrings()}
+
+	assert.Assert(t, !state.newCapacityNotAvailable(reqs(map[string]string{
+		"sir-1": "pending-evaluation",
+	})))
+	assert.Assert(t, state.newCapacityNotAvailable(reqs(map[string]string{
+		"sir-1": "capacity-not-available",
+		"sir-2": "capacity-not-available",
+	})))
+	// Requests that keep reporting capacity-not-available on later ticks aren't new failures.
+	assert.Assert(t, !state.newCapacityNotAvailable(reqs(map[string]string{
+		"sir-1": "capacity-not-available",
+		"sir-2": "capacity-not-available",
+	})))
+	assert.Assert(t, state.newCapacityNotAvailable(reqs(map[string]string{
+		"sir-2": "capacity-not-available",
+		"sir-3": "capacity-not-available",
+	})))
+}
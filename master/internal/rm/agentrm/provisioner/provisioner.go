@@ -61,12 +61,14 @@ func New(
 		return nil, err
 	}
 	var cluster provider
+	var minInstanceLifetime time.Duration
 	switch {
 	case config.AWS != nil:
 		var err error
 		if cluster, err = newAWSCluster(resourcePool, config, cert); err != nil {
 			return nil, errors.Wrap(err, "cannot create an EC2 cluster")
 		}
+		minInstanceLifetime = time.Duration(config.AWS.MinInstanceLifetime)
 	case config.GCP != nil:
 		var err error
 		if cluster, err = newGCPCluster(resourcePool, config, cert); err != nil {
@@ -81,6 +83,7 @@ func New(
 			time.Duration(config.MaxIdleAgentPeriod),
 			time.Duration(config.MaxAgentStartingPeriod),
 			maxDisconnectPeriod,
+			minInstanceLifetime,
 			config.MinInstances,
 			config.MaxInstances,
 			db,
@@ -60,6 +60,7 @@ func newMockEnvironment(t *testing.T, setup *mockConfig) *mockEnvironment {
 			time.Duration(setup.MaxIdleAgentPeriod),
 			time.Duration(setup.MaxAgentStartingPeriod),
 			setup.maxDisconnectPeriod,
+			0,
 			setup.MinInstances,
 			setup.MaxInstances,
 			nil,
@@ -31,6 +31,7 @@ type scaleDecider struct {
 	maxIdlePeriod       time.Duration
 	maxStartingPeriod   time.Duration
 	maxDisconnectPeriod time.Duration
+	minInstanceLifetime time.Duration
 	minInstanceNum      int
 	maxInstanceNum      int
 
@@ -55,7 +56,7 @@ type scaleDecider struct {
 func newScaleDecider(
 	resourcePool string,
 	maxIdlePeriod, maxStartingPeriod,
-	maxDisconnectPeriod time.Duration,
+	maxDisconnectPeriod, minInstanceLifetime time.Duration,
 	minInstanceNum int,
 	maxInstanceNum int,
 	db db.DB,
@@ -64,6 +65,7 @@ func newScaleDecider(
 		maxStartingPeriod:      maxStartingPeriod,
 		maxIdlePeriod:          maxIdlePeriod,
 		maxDisconnectPeriod:    maxDisconnectPeriod,
+		minInstanceLifetime:    minInstanceLifetime,
 		minInstanceNum:         minInstanceNum,
 		maxInstanceNum:         maxInstanceNum,
 		instanceSnapshot:       make(map[string]*model.Instance),
@@ -251,8 +253,11 @@ func (s *scaleDecider) findInstancesToTerminate() sproto.TerminateDecision {
 		delete(s.disconnected, id)
 	}
 
-	// Terminate instances that are idle for a long time.
+	// Terminate instances that are idle for a long time, unless they were launched too recently.
 	for id := range s.longIdle {
+		if s.withinMinInstanceLifetime(id) {
+			continue
+		}
 		if len(s.instances)-len(toTerminate) > s.minInstanceNum {
 			toTerminate[id] = sproto.TerminateLongIdleInstances
 			delete(s.idle, id)
@@ -308,6 +313,16 @@ func (s *scaleDecider) findInstancesToTerminate() sproto.TerminateDecision {
 	return res
 }
 
+// withinMinInstanceLifetime returns true if the instance has not yet been alive for the minimum
+// instance lifetime and so should be protected from being scaled down for being idle.
+func (s *scaleDecider) withinMinInstanceLifetime(id string) bool {
+	inst, ok := s.instances[id]
+	if !ok || s.minInstanceLifetime <= 0 {
+		return false
+	}
+	return inst.LaunchTime.Add(s.minInstanceLifetime).After(time.Now())
+}
+
 func (s *scaleDecider) calculateNumInstancesToLaunch() int {
 	return mathx.Max(0, mathx.Clamp(
 		s.minInstanceNum-len(s.instances),
@@ -203,6 +203,28 @@ func TestFindInstancesToTerminate(t *testing.T) {
 			},
 			toTerminate: []string{"long idle"},
 		},
+		{
+			name: "don't terminate long idle instances within the minimum lifetime",
+			scaleDecider: scaleDecider{
+				instances: map[string]*model.Instance{
+					"young long idle": {
+						ID:         "young long idle",
+						LaunchTime: time.Now().Add(-5 * time.Minute),
+					},
+					"old long idle": {
+						ID:         "old long idle",
+						LaunchTime: time.Now().Add(-time.Hour),
+					},
+				},
+				longIdle: map[string]bool{
+					"young long idle": true,
+					"old long idle":   true,
+				},
+				minInstanceLifetime: 30 * time.Minute,
+				maxInstanceNum:      10,
+			},
+			toTerminate: []string{"old long idle"},
+		},
 		{
 			name: "terminate long disconnected",
 			scaleDecider: scaleDecider{
@@ -6,6 +6,7 @@ import (
 	"compress/gzip"
 	"fmt"
 	"io"
+	"math"
 	"strings"
 )
 
@@ -17,10 +18,50 @@ const (
 	ArchiveTgz = "tgz"
 	// ArchiveZip is a zip file.
 	ArchiveZip = "zip"
+	// ArchiveZipStored is a zip file with uncompressed entries, whose size ArchiveSize can
+	// predict.
+	ArchiveZipStored = "zip-stored"
 	// ArchiveUnknown represents an unknown archive type.
 	ArchiveUnknown = "unknown"
 )
 
+// Sizes of the fixed-length zip records written by zip.Writer, excluding names.
+const (
+	zipLocalHeaderLen    = 30
+	zipDataDescriptorLen = 16
+	zipCentralHeaderLen  = 46
+	zipEndLen            = 22
+)
+
+// Entry describes a file to be written to an archive.
+type Entry struct {
+	Path string
+	Size int64
+}
+
+// ArchiveSize returns the exact size of an archive of archiveType holding entries, written in
+// order through an ArchiveWriter, and whether that size can be known before writing it. Only
+// stored zip archives small enough not to need zip64 records are predictable; compressed output
+// never is.
+func ArchiveSize(archiveType ArchiveType, entries []Entry) (int64, bool) {
+	if archiveType != ArchiveZipStored || len(entries) >= math.MaxUint16 {
+		return 0, false
+	}
+	size := int64(zipEndLen)
+	for _, e := range entries {
+		name := int64(len(e.Path))
+		size += zipLocalHeaderLen + name + zipCentralHeaderLen + name
+		if !strings.HasSuffix(e.Path, "/") {
+			// Directories have no content and are written without a data descriptor.
+			size += e.Size + zipDataDescriptorLen
+		}
+	}
+	if size >= math.MaxUint32 {
+		return 0, false
+	}
+	return size, true
+}
+
 // ArchiveWriter defines an interface to create an archive file.
 type ArchiveWriter interface {
 	WriteHeader(path string, size int64) error
@@ -41,15 +82,29 @@ func NewArchiveWriter(w io.Writer, archiveType ArchiveType) (ArchiveWriter, erro
 
 		return &tarArchiveWriter{archiveClosers{closers}, tw}, nil
 
-	case ArchiveZip:
+	case ArchiveZip, ArchiveZipStored:
 		zw := zip.NewWriter(w)
 		closers = append(closers, zw)
 
-		return &zipArchiveWriter{archiveClosers{closers}, zw, nil}, nil
+		method := zip.Deflate
+		if archiveType == ArchiveZipStored {
+			method = zip.Store
+		}
+		return &zipArchiveWriter{archiveClosers{closers}, zw, method, nil}, nil
+
+	default:
+		return nil, CheckArchiveType(archiveType)
+	}
+}
 
+// CheckArchiveType returns an error if NewArchiveWriter does not support archiveType.
+func CheckArchiveType(archiveType ArchiveType) error {
+	switch archiveType {
+	case ArchiveTgz, ArchiveZip, ArchiveZipStored:
+		return nil
 	default:
-		return nil, fmt.Errorf(
-			"archive type must be %s or %s but got %s", ArchiveTgz, ArchiveZip, archiveType)
+		return fmt.Errorf("archive type must be %s, %s or %s but got %s",
+			ArchiveTgz, ArchiveZip, ArchiveZipStored, archiveType)
 	}
 }
 
@@ -93,12 +148,16 @@ func (aw *tarArchiveWriter) Write(p []byte) (int, error) {
 type zipArchiveWriter struct {
 	archiveClosers
 	zw        *zip.Writer
+	method    uint16
 	zwContent io.Writer
 }
 
 func (aw *zipArchiveWriter) WriteHeader(path string, size int64) error {
 	// Zip by default sets mode 0666 and 0777 for files and folders respectively.
-	zwc, err := aw.zw.Create(path)
+	// Entries are streamed with a data descriptor, and zip.Writer switches to zip64
+	// descriptors and directory records once an entry, offset, or the archive itself
+	// crosses the 32-bit limits, so checkpoints larger than 4GB need no special casing.
+	zwc, err := aw.zw.CreateHeader(&zip.FileHeader{Name: path, Method: aw.method})
 	if err != nil {
 		return err
 	}
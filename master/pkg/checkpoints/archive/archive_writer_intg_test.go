@@ -0,0 +1,125 @@
+//go:build integration
+// +build integration
+
+package archive
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"math"
+	"sort"
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+// sparseBuffer is an in-memory io.Writer and io.ReaderAt that stores runs of zeros without
+// allocating them, so that archives with huge zero-filled entries fit in memory.
+type sparseBuffer struct {
+	segments []sparseSegment
+	size     int64
+}
+
+type sparseSegment struct {
+	off   int64
+	zeros int64
+	data  []byte
+}
+
+func (s sparseSegment) len() int64 {
+	if s.data != nil {
+		return int64(len(s.data))
+	}
+	return s.zeros
+}
+
+func (b *sparseBuffer) Write(p []byte) (int, error) {
+	if len(p) > 0 && bytes.Count(p, []byte{0}) == len(p) {
+		if n := len(b.segments); n > 0 && b.segments[n-1].data == nil {
+			b.segments[n-1].zeros += int64(len(p))
+		} else {
+			b.segments = append(b.segments, sparseSegment{off: b.size, zeros: int64(len(p))})
+		}
+	} else {
+		b.segments = append(b.segments, sparseSegment{off: b.size, data: append([]byte{}, p...)})
+	}
+	b.size += int64(len(p))
+	return len(p), nil
+}
+
+func (b *sparseBuffer) ReadAt(p []byte, off int64) (int, error) {
+	n := 0
+	i := sort.Search(len(b.segments), func(i int) bool {
+		return b.segments[i].off+b.segments[i].len() > off
+	})
+	for ; n < len(p) && i < len(b.segments); i++ {
+		s := b.segments[i]
+		start := off + int64(n) - s.off
+		end := s.len()
+		if remaining := int64(len(p) - n); end-start > remaining {
+			end = start + remaining
+		}
+		if s.data != nil {
+			copy(p[n:], s.data[start:end])
+		} else {
+			for j := int64(0); j < end-start; j++ {
+				p[n+int(j)] = 0
+			}
+		}
+		n += int(end - start)
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func TestZipArchiveWriterZip64(t *testing.T) {
+	const size = int64(math.MaxUint32) + 1
+	chunk := make([]byte, 1<<20)
+
+	// Entries are stored uncompressed, so only count the bytes of the archive and
+	// keep the rest for reading it back.
+	var buf sparseBuffer
+	aw, err := NewArchiveWriter(&buf, ArchiveZipStored)
+	assert.NilError(t, err)
+
+	assert.NilError(t, aw.WriteHeader("large/", 0))
+	assert.NilError(t, aw.WriteHeader("large/weights.bin", size))
+	for remaining := size; remaining > 0; {
+		n := int64(len(chunk))
+		if remaining < n {
+			n = remaining
+		}
+		_, err = aw.Write(chunk[:n])
+		assert.NilError(t, err)
+		remaining -= n
+	}
+	assert.NilError(t, aw.WriteHeader("large/metadata.json", 2))
+	_, err = aw.Write([]byte("{}"))
+	assert.NilError(t, err)
+	assert.NilError(t, aw.Close())
+
+	zr, err := zip.NewReader(&buf, buf.size)
+	assert.NilError(t, err)
+	assert.Equal(t, len(zr.File), 3)
+
+	large := zr.File[1]
+	assert.Equal(t, large.Name, "large/weights.bin")
+	assert.Equal(t, large.UncompressedSize64, uint64(size))
+	rc, err := large.Open()
+	assert.NilError(t, err)
+	// Reading to EOF also verifies the CRC-32 of the entry.
+	n, err := io.Copy(io.Discard, rc)
+	assert.NilError(t, err)
+	assert.Equal(t, n, size)
+	assert.NilError(t, rc.Close())
+
+	rc, err = zr.File[2].Open()
+	assert.NilError(t, err)
+	content, err := io.ReadAll(rc)
+	assert.NilError(t, err)
+	assert.Equal(t, string(content), "{}")
+	assert.NilError(t, rc.Close())
+}
@@ -0,0 +1,69 @@
+package archive
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"math"
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+func TestZipArchiveWriterCompression(t *testing.T) {
+	content := bytes.Repeat([]byte("checkpoint"), 1<<16)
+	for archiveType, method := range map[ArchiveType]uint16{
+		ArchiveZip:       zip.Deflate,
+		ArchiveZipStored: zip.Store,
+	} {
+		var buf bytes.Buffer
+		aw, err := NewArchiveWriter(&buf, archiveType)
+		assert.NilError(t, err)
+		assert.NilError(t, aw.WriteHeader("data.txt", int64(len(content))))
+		_, err = aw.Write(content)
+		assert.NilError(t, err)
+		assert.NilError(t, aw.Close())
+
+		zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		assert.NilError(t, err)
+		assert.Equal(t, len(zr.File), 1)
+		assert.Equal(t, zr.File[0].Method, method, archiveType)
+		rc, err := zr.File[0].Open()
+		assert.NilError(t, err)
+		got, err := io.ReadAll(rc)
+		assert.NilError(t, err)
+		assert.NilError(t, rc.Close())
+		assert.DeepEqual(t, got, content)
+	}
+}
+
+func TestArchiveSize(t *testing.T) {
+	entries := []Entry{
+		{Path: "emptyDir", Size: 0},
+		{Path: "lib/", Size: 0},
+		{Path: "lib/math.py", Size: 29},
+		{Path: "data.txt", Size: 1 << 20},
+		{Path: "ünïcode.txt", Size: 3},
+	}
+
+	var buf bytes.Buffer
+	aw, err := NewArchiveWriter(&buf, ArchiveZipStored)
+	assert.NilError(t, err)
+	for _, e := range entries {
+		assert.NilError(t, aw.WriteHeader(e.Path, e.Size))
+		_, err = aw.Write(bytes.Repeat([]byte("x"), int(e.Size)))
+		assert.NilError(t, err)
+	}
+	assert.NilError(t, aw.Close())
+
+	size, ok := ArchiveSize(ArchiveZipStored, entries)
+	assert.Assert(t, ok)
+	assert.Equal(t, size, int64(buf.Len()))
+
+	_, ok = ArchiveSize(ArchiveTgz, entries)
+	assert.Assert(t, !ok)
+	_, ok = ArchiveSize(ArchiveZip, entries)
+	assert.Assert(t, !ok)
+	_, ok = ArchiveSize(ArchiveZipStored, []Entry{{Path: "weights.bin", Size: math.MaxUint32}})
+	assert.Assert(t, !ok)
+}
@@ -2,6 +2,7 @@ package checkpoints
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"strings"
@@ -9,11 +10,21 @@ import (
 	"github.com/determined-ai/determined/master/pkg/checkpoints/archive"
 	"github.com/determined-ai/determined/master/pkg/checkpoints/gcs"
 	"github.com/determined-ai/determined/master/pkg/checkpoints/s3"
+	"github.com/determined-ai/determined/master/pkg/checkpoints/sharedfs"
 	"github.com/determined-ai/determined/master/pkg/schemas/expconf"
 )
 
+// ErrUnsupportedStorage is returned by NewDownloader for checkpoint storage backends that
+// checkpoints cannot be downloaded from through the master.
+var ErrUnsupportedStorage = errors.New("checkpoint download via master is not supported")
+
 // CheckpointDownloader defines the interface for downloading checkpoints.
 type CheckpointDownloader interface {
+	// Files lists the checkpoint files that Download writes. The listing is shared with Size
+	// and Download, so the checkpoint is listed once.
+	Files(ctx context.Context) ([]File, error)
+	// Size returns the size of the archive Download writes, and whether it is known in advance.
+	Size(ctx context.Context) (int64, bool, error)
 	Download(ctx context.Context) error
 	Close() error
 }
@@ -25,36 +36,96 @@ type CheckpointDownloader interface {
 // - storageConfig: the CheckpointStorageConfig
 // - archiveType: The ArchiveType (file format) in which the checkpoint shall
 //                be downloaded
+// - globs: if nonempty, only files matching one of these globs are downloaded,
+//          and Download returns ErrNoMatchingFiles if none do
+// - s3Concurrency: the number of objects fetched concurrently from S3
 func NewDownloader(
 	w io.Writer,
 	id string,
 	storageConfig *expconf.CheckpointStorageConfig,
 	archiveType archive.ArchiveType,
+	globs []string,
+	s3Concurrency int,
 ) (CheckpointDownloader, error) {
-	aw, err := archive.NewArchiveWriter(w, archiveType)
+	filter, err := newPathFilter(globs)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := archive.CheckArchiveType(archiveType); err != nil {
+		return nil, err
+	}
+
+	backend, prefix, err := newStorageBackend(id, storageConfig)
+	if err != nil {
+		return nil, err
+	}
+	prefetch := 1
+	if _, ok := storageConfig.GetUnionMember().(expconf.S3Config); ok {
+		prefetch = s3Concurrency
+	}
+	return newArchiveDownloader(backend, w, archiveType, prefix, filter, prefetch), nil
+}
+
+// ListFiles lists the files of a checkpoint that a CheckpointDownloader created with the same
+// arguments would download. It returns ErrNoMatchingFiles if globs are given and none match.
+func ListFiles(
+	ctx context.Context,
+	id string,
+	storageConfig *expconf.CheckpointStorageConfig,
+	globs []string,
+) ([]File, error) {
+	filter, err := newPathFilter(globs)
 	if err != nil {
 		return nil, err
 	}
+	backend, prefix, err := newStorageBackend(id, storageConfig)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = backend.Close()
+	}()
 
+	// Listing never writes an archive, so the downloader needs no ArchiveWriter or buffer.
+	d := &archiveDownloader{backend: backend, prefix: prefix + "/", filter: filter}
+	files, err := d.Files(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(globs) > 0 && len(files) == 0 {
+		return nil, ErrNoMatchingFiles
+	}
+	return files, nil
+}
+
+// newStorageBackend returns the StorageBackend for storageConfig and the prefix under which the
+// checkpoint with the given id is stored.
+func newStorageBackend(
+	id string, storageConfig *expconf.CheckpointStorageConfig,
+) (StorageBackend, string, error) {
+	var backend StorageBackend
 	prefix := ""
 	switch storage := storageConfig.GetUnionMember().(type) {
 	case expconf.S3Config:
 		if storage.Prefix() != nil {
 			prefix = *storage.Prefix()
 		}
-		return s3.NewS3Downloader(
-			aw, storage.Bucket(), strings.TrimLeft(prefix+"/"+id, "/")), nil
+		backend = s3.NewS3Backend(storage.Bucket())
 	case expconf.GCSConfig:
 		if storage.Prefix() != nil {
 			prefix = *storage.Prefix()
 		}
-		return gcs.NewGCSDownloader(
-			aw, storage.Bucket(), strings.TrimLeft(prefix+"/"+id, "/")), nil
+		backend = gcs.NewGCSBackend(storage.Bucket())
+	case expconf.SharedFSConfig:
+		// This requires the shared filesystem to be mounted on the master at the same host path
+		// as on the agents.
+		backend = sharedfs.NewSharedFSBackend(storage.PathInHost())
 	default:
-		return nil,
-			fmt.Errorf("checkpoint download via master is not supported for %s",
-				storageConfig2Str(storage))
+		return nil, "", fmt.Errorf("%w for %s backend", ErrUnsupportedStorage,
+			storageConfig2Str(storage))
 	}
+	return backend, strings.TrimLeft(prefix+"/"+id, "/"), nil
 }
 
 func storageConfig2Str(config any) string {
@@ -0,0 +1,275 @@
+package checkpoints
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/docker/go-units"
+
+	"github.com/determined-ai/determined/master/pkg/checkpoints/archive"
+)
+
+// copyBufferSize is the size of the buffer used to copy each object into the archive.
+const copyBufferSize = units.MiB * 5
+
+// prefetchSizeLimit is the size up to which prefetched objects are read into memory; larger
+// objects are opened ahead of time but streamed into the archive.
+const prefetchSizeLimit = units.MiB
+
+// StorageBackend is the checkpoint storage that checkpoint files are downloaded from.
+type StorageBackend interface {
+	// ListObjects calls fn with the key, size, and ETag (empty if the backend has none) of every
+	// object under prefix, stopping at the first error fn returns.
+	ListObjects(
+		ctx context.Context, prefix string, fn func(key string, size int64, etag string) error,
+	) error
+	// OpenObject returns a reader for the content of the object with the given key.
+	OpenObject(ctx context.Context, key string) (io.ReadCloser, error)
+	Close() error
+}
+
+// File describes a checkpoint file.
+type File struct {
+	// Path is the path of the file relative to the checkpoint.
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+	// ETag is the storage backend's ETag for the file, if it has one. For S3 objects that were
+	// not uploaded in multiple parts, this is the MD5 of the content.
+	ETag string `json:"etag,omitempty"`
+}
+
+// archiveDownloader implements downloading a checkpoint from a StorageBackend
+// and sends it to the client in an archive file.
+type archiveDownloader struct {
+	backend StorageBackend
+	w       io.Writer
+	// aw is created by Download, once Size has had the chance to choose the zip layout.
+	aw          archive.ArchiveWriter
+	archiveType archive.ArchiveType
+	prefix      string
+	filter      *pathFilter
+	buffer      []byte
+	// prefetch is the number of objects fetched concurrently ahead of the one being written.
+	prefetch int
+	// files caches the listing made by Files, so that Size, Files, and Download list the
+	// checkpoint once.
+	files  []File
+	listed bool
+}
+
+func newArchiveDownloader(
+	backend StorageBackend,
+	w io.Writer,
+	archiveType archive.ArchiveType,
+	prefix string,
+	filter *pathFilter,
+	prefetch int,
+) *archiveDownloader {
+	if !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	if prefetch < 1 {
+		prefetch = 1
+	}
+	return &archiveDownloader{
+		backend:     backend,
+		w:           w,
+		archiveType: archiveType,
+		prefix:      prefix,
+		filter:      filter,
+		buffer:      make([]byte, copyBufferSize),
+		prefetch:    prefetch,
+	}
+}
+
+// Files lists the checkpoint files that Download writes. The listing is made once and reused
+// by later calls to Files, Size, and Download.
+func (d *archiveDownloader) Files(ctx context.Context) ([]File, error) {
+	if d.listed {
+		return d.files, nil
+	}
+	var files []File
+	err := d.backend.ListObjects(ctx, d.prefix, func(key string, size int64, etag string) error {
+		path := strings.TrimPrefix(key, d.prefix)
+		if d.filter.match(path) {
+			files = append(files, File{Path: path, Size: size, ETag: etag})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("checkpoint listing failed: %w", err)
+	}
+	d.files, d.listed = files, true
+	return files, nil
+}
+
+// Size computes the size of the archive from the listing made by Files, which Download then
+// writes. Zip archives are written uncompressed whenever that makes their size predictable, so
+// that downloads can report it, and compressed otherwise.
+func (d *archiveDownloader) Size(ctx context.Context) (int64, bool, error) {
+	archiveType := d.archiveType
+	if archiveType == archive.ArchiveZip {
+		archiveType = archive.ArchiveZipStored
+	}
+	if _, ok := archive.ArchiveSize(archiveType, nil); !ok {
+		return 0, false, nil
+	}
+	files, err := d.Files(ctx)
+	if err != nil {
+		return 0, false, err
+	}
+	entries := make([]archive.Entry, 0, len(files))
+	for _, f := range files {
+		entries = append(entries, archive.Entry{Path: f.Path, Size: f.Size})
+	}
+	size, ok := archive.ArchiveSize(archiveType, entries)
+	if ok {
+		d.archiveType = archiveType
+	}
+	return size, ok, nil
+}
+
+// object is a checkpoint object to be written to the archive.
+type object struct {
+	key  string
+	path string
+	size int64
+}
+
+// fetchResult is the outcome of fetching an object ahead of writing it.
+type fetchResult struct {
+	r   io.ReadCloser
+	err error
+}
+
+// fetch opens the object, reading it fully into memory if it is small.
+func (d *archiveDownloader) fetch(ctx context.Context, obj object) fetchResult {
+	r, err := d.backend.OpenObject(ctx, obj.key)
+	if err != nil {
+		return fetchResult{err: err}
+	}
+	if obj.size > prefetchSizeLimit {
+		return fetchResult{r: r}
+	}
+	defer func() {
+		_ = r.Close()
+	}()
+	buf := make([]byte, obj.size)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return fetchResult{err: fmt.Errorf("reading object %s: %w", obj.key, err)}
+	}
+	return fetchResult{r: io.NopCloser(bytes.NewReader(buf))}
+}
+
+func (d *archiveDownloader) writeObject(obj object, r io.Reader) error {
+	if err := d.aw.WriteHeader(obj.path, obj.size); err != nil {
+		return err
+	}
+	n, err := io.CopyBuffer(d.aw, r, d.buffer)
+	if err != nil {
+		return err
+	}
+	if n != obj.size {
+		return fmt.Errorf("object %s is %d bytes, expected %d", obj.key, n, obj.size)
+	}
+	return nil
+}
+
+// writeObjects writes the objects to the archive in order, fetching up to d.prefetch of them
+// concurrently. The first error aborts the download and cancels any outstanding fetches.
+func (d *archiveDownloader) writeObjects(ctx context.Context, objects []object) error {
+	ctx, cancel := context.WithCancel(ctx)
+	results := make([]chan fetchResult, len(objects))
+	for i := range results {
+		results[i] = make(chan fetchResult, 1)
+	}
+	// slots bounds the number of objects that have been fetched but not yet written.
+	slots := make(chan struct{}, d.prefetch)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i, obj := range objects {
+			select {
+			case slots <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			wg.Add(1)
+			go func(i int, obj object) {
+				defer wg.Done()
+				results[i] <- d.fetch(ctx, obj)
+			}(i, obj)
+		}
+	}()
+	defer func() {
+		cancel()
+		wg.Wait()
+		for _, ch := range results {
+			select {
+			case res := <-ch:
+				if res.r != nil {
+					_ = res.r.Close()
+				}
+			default:
+			}
+		}
+	}()
+
+	for i, obj := range objects {
+		var res fetchResult
+		select {
+		case res = <-results[i]:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if res.err != nil {
+			return res.err
+		}
+		err := d.writeObject(obj, res.r)
+		_ = res.r.Close()
+		<-slots
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Download downloads the checkpoint, reusing the listing made by Files or Size if there is one so
+// that the archive matches the size reported for it.
+func (d *archiveDownloader) Download(ctx context.Context) error {
+	files, err := d.Files(ctx)
+	if err != nil {
+		return err
+	}
+	if len(d.filter.globs) > 0 && len(files) == 0 {
+		return ErrNoMatchingFiles
+	}
+	objects := make([]object, 0, len(files))
+	for _, f := range files {
+		objects = append(objects, object{key: d.prefix + f.Path, path: f.Path, size: f.Size})
+	}
+	if d.aw, err = archive.NewArchiveWriter(d.w, d.archiveType); err != nil {
+		return err
+	}
+	if err := d.writeObjects(ctx, objects); err != nil {
+		return fmt.Errorf("checkpoint download failed: %w", err)
+	}
+	return nil
+}
+
+// Close closes the underlying ArchiveWriter, if Download created one, and StorageBackend.
+func (d *archiveDownloader) Close() error {
+	if d.aw != nil {
+		if err := d.aw.Close(); err != nil {
+			return err
+		}
+	}
+	return d.backend.Close()
+}
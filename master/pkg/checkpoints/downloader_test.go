@@ -0,0 +1,219 @@
+package checkpoints
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/determined-ai/determined/master/pkg/checkpoints/archive"
+)
+
+// memBackend is an in-memory StorageBackend.
+type memBackend struct {
+	objects map[string]string
+	closed  bool
+	lists   int
+}
+
+func (b *memBackend) ListObjects(
+	ctx context.Context, prefix string, fn func(key string, size int64, etag string) error,
+) error {
+	b.lists++
+	var keys []string
+	for key := range b.objects {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if err := fn(key, int64(len(b.objects[key])), "etag:"+key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *memBackend) OpenObject(ctx context.Context, key string) (io.ReadCloser, error) {
+	content, ok := b.objects[key]
+	if !ok {
+		return nil, errors.New("no such key: " + key)
+	}
+	return io.NopCloser(strings.NewReader(content)), nil
+}
+
+func (b *memBackend) Close() error {
+	b.closed = true
+	return nil
+}
+
+// failingBackend is a StorageBackend that fails to open one of its objects.
+type failingBackend struct {
+	StorageBackend
+	failKey string
+}
+
+func (b *failingBackend) OpenObject(ctx context.Context, key string) (io.ReadCloser, error) {
+	if key == b.failKey {
+		return nil, errors.New("injected failure")
+	}
+	return b.StorageBackend.OpenObject(ctx, key)
+}
+
+func downloadZip(
+	t *testing.T, backend StorageBackend, prefix string, globs []string, prefetch int,
+) (map[string]string, error) {
+	filter, err := newPathFilter(globs)
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	d := newArchiveDownloader(backend, &buf, archive.ArchiveZip, prefix, filter, prefetch)
+	size, ok, err := d.Size(context.Background())
+	require.NoError(t, err)
+	require.True(t, ok)
+	if err := d.Download(context.Background()); err != nil {
+		return nil, err
+	}
+	require.NoError(t, d.Close())
+	require.Equal(t, size, int64(buf.Len()))
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+	got := make(map[string]string)
+	var names []string
+	for _, f := range zr.File {
+		// Size predicted the archive, so its entries are stored uncompressed.
+		require.Equal(t, zip.Store, f.Method)
+		names = append(names, f.Name)
+		rc, err := f.Open()
+		require.NoError(t, err)
+		content, err := io.ReadAll(rc)
+		require.NoError(t, err)
+		require.NoError(t, rc.Close())
+		got[f.Name] = string(content)
+	}
+	require.True(t, sort.StringsAreSorted(names), "archive entries out of order: %v", names)
+	return got, nil
+}
+
+func TestArchiveDownloader(t *testing.T) {
+	backend := &memBackend{objects: map[string]string{
+		"prefix/uuid/data.txt":    "This is mock data.",
+		"prefix/uuid/lib/math.py": "def triple(x):\n  return x * 3",
+		"prefix/uuid2/other.txt":  "another checkpoint",
+	}}
+
+	got, err := downloadZip(t, backend, "prefix/uuid", nil, 1)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{
+		"data.txt":    "This is mock data.",
+		"lib/math.py": "def triple(x):\n  return x * 3",
+	}, got)
+	require.True(t, backend.closed)
+
+	got, err = downloadZip(t, backend, "prefix/uuid", []string{"lib"}, 1)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"lib/math.py": "def triple(x):\n  return x * 3"}, got)
+
+	_, err = downloadZip(t, backend, "prefix/uuid", []string{"*.ckpt"}, 1)
+	require.True(t, errors.Is(err, ErrNoMatchingFiles))
+
+	filter, err := newPathFilter([]string{"lib"})
+	require.NoError(t, err)
+	d := newArchiveDownloader(backend, nil, archive.ArchiveZip, "prefix/uuid", filter, 1)
+	files, err := d.Files(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []File{{
+		Path: "lib/math.py",
+		Size: int64(len(backend.objects["prefix/uuid/lib/math.py"])),
+		ETag: "etag:prefix/uuid/lib/math.py",
+	}}, files)
+}
+
+func TestArchiveDownloaderListsOnce(t *testing.T) {
+	backend := &memBackend{objects: map[string]string{
+		"prefix/uuid/data.txt":    "This is mock data.",
+		"prefix/uuid/lib/math.py": "def triple(x):\n  return x * 3",
+	}}
+	filter, err := newPathFilter(nil)
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	d := newArchiveDownloader(backend, &buf, archive.ArchiveZip, "prefix/uuid", filter, 1)
+
+	// A HEAD request asks for both the archive size and the files.
+	size, ok, err := d.Size(context.Background())
+	require.NoError(t, err)
+	require.True(t, ok)
+	files, err := d.Files(context.Background())
+	require.NoError(t, err)
+	require.Len(t, files, 2)
+
+	// A GET request writes the archive listed by Size, even if the checkpoint changes meanwhile.
+	backend.objects["prefix/uuid/new.txt"] = "written after listing"
+	require.NoError(t, d.Download(context.Background()))
+	require.NoError(t, d.Close())
+	require.Equal(t, size, int64(buf.Len()))
+	require.Equal(t, 1, backend.lists)
+}
+
+func TestArchiveDownloaderZipCompressedWithoutSize(t *testing.T) {
+	backend := &memBackend{objects: map[string]string{"prefix/uuid/data.txt": "mock data"}}
+	filter, err := newPathFilter(nil)
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	d := newArchiveDownloader(backend, &buf, archive.ArchiveZip, "prefix/uuid", filter, 1)
+	require.NoError(t, d.Download(context.Background()))
+	require.NoError(t, d.Close())
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+	require.Len(t, zr.File, 1)
+	require.Equal(t, zip.Deflate, zr.File[0].Method)
+}
+
+func TestArchiveDownloaderPrefetch(t *testing.T) {
+	objects := make(map[string]string)
+	expected := make(map[string]string)
+	for i := 0; i < 50; i++ {
+		name := fmt.Sprintf("file%02d.txt", i)
+		content := strings.Repeat(name, i)
+		objects["prefix/uuid/"+name] = content
+		expected[name] = content
+	}
+	// One object is large enough to be streamed rather than read into memory.
+	large := strings.Repeat("x", prefetchSizeLimit+1)
+	objects["prefix/uuid/large.bin"] = large
+	expected["large.bin"] = large
+	backend := &memBackend{objects: objects}
+
+	for _, prefetch := range []int{1, 8, 100} {
+		got, err := downloadZip(t, backend, "prefix/uuid", nil, prefetch)
+		require.NoError(t, err)
+		require.Equal(t, expected, got)
+	}
+
+	failing := &failingBackend{StorageBackend: backend, failKey: "prefix/uuid/file10.txt"}
+	for _, prefetch := range []int{1, 8} {
+		_, err := downloadZip(t, failing, "prefix/uuid", nil, prefetch)
+		require.ErrorContains(t, err, "injected failure")
+	}
+
+	// An object shorter than its listed size aborts the download rather than truncating it.
+	short := &memBackend{objects: map[string]string{"prefix/uuid/a.txt": "abc"}}
+	filter, err := newPathFilter(nil)
+	require.NoError(t, err)
+	d := newArchiveDownloader(short, io.Discard, archive.ArchiveZip, "prefix/uuid", filter, 8)
+	d.aw, err = archive.NewArchiveWriter(io.Discard, archive.ArchiveZip)
+	require.NoError(t, err)
+	err = d.writeObjects(context.Background(), []object{
+		{key: "prefix/uuid/a.txt", path: "a.txt", size: 4},
+	})
+	require.ErrorContains(t, err, "prefix/uuid/a.txt")
+}
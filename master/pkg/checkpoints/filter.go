@@ -0,0 +1,43 @@
+package checkpoints
+
+import (
+	"errors"
+	"fmt"
+	"path"
+)
+
+// ErrNoMatchingFiles is returned by Download when none of the checkpoint files match the
+// requested globs.
+var ErrNoMatchingFiles = errors.New("no checkpoint files match the requested globs")
+
+// pathFilter selects checkpoint files by their path relative to the checkpoint. A glob matches
+// a file if it matches the file's path or any of its parent directories, so "lib" selects
+// everything under lib/. An empty filter selects every file.
+type pathFilter struct {
+	globs []string
+}
+
+func newPathFilter(globs []string) (*pathFilter, error) {
+	for _, glob := range globs {
+		if _, err := path.Match(glob, ""); err != nil {
+			return nil, fmt.Errorf("invalid glob %q: %w", glob, err)
+		}
+	}
+	return &pathFilter{globs: globs}, nil
+}
+
+// match reports whether the file at p should be downloaded.
+func (f *pathFilter) match(p string) bool {
+	if len(f.globs) == 0 {
+		return true
+	}
+	for p = path.Clean(p); p != "." && p != "/"; p = path.Dir(p) {
+		for _, glob := range f.globs {
+			// Errors are impossible here since the globs were checked by newPathFilter.
+			if ok, _ := path.Match(path.Clean(glob), p); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,36 @@
+package checkpoints
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPathFilter(t *testing.T) {
+	paths := []string{"data.txt", "emptyDir", "lib/big-data.txt", "lib/math.py", "print.py"}
+	cases := []struct {
+		globs []string
+		want  []string
+	}{
+		{nil, paths},
+		{[]string{"*.py"}, []string{"print.py"}},
+		{[]string{"lib"}, []string{"lib/big-data.txt", "lib/math.py"}},
+		{[]string{"lib/"}, []string{"lib/big-data.txt", "lib/math.py"}},
+		{[]string{"lib/*.py", "data.txt"}, []string{"data.txt", "lib/math.py"}},
+		{[]string{"*.ckpt"}, nil},
+	}
+	for _, c := range cases {
+		filter, err := newPathFilter(c.globs)
+		require.NoError(t, err)
+		var got []string
+		for _, p := range paths {
+			if filter.match(p) {
+				got = append(got, p)
+			}
+		}
+		require.Equal(t, c.want, got, "globs: %v", c.globs)
+	}
+
+	_, err := newPathFilter([]string{"lib/[.py"})
+	require.ErrorContains(t, err, `invalid glob "lib/[.py"`)
+}
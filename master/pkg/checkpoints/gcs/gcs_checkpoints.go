@@ -2,108 +2,78 @@ package gcs
 
 import (
 	"context"
-	"fmt"
-	"strings"
+	"io"
+	"sync"
 
 	"cloud.google.com/go/storage"
-	"github.com/docker/go-units"
 	"google.golang.org/api/iterator"
-
-	"github.com/determined-ai/determined/master/pkg/checkpoints/archive"
 )
 
-// GCSDownloader implements downloading a checkpoint from GCS
-// and sends it to the client in an archive file.
-type GCSDownloader struct {
-	aw     archive.ArchiveWriter
+// GCSBackend implements listing and reading checkpoint files stored in a GCS bucket.
+type GCSBackend struct {
 	bucket string
-	prefix string
-	buffer []byte
-}
 
-// DefaultDownloadPartSize is the default part size for downloading files from GCS.
-// This is the same as the default part size for S3.
-const DefaultDownloadPartSize = units.MiB * 5
+	mu     sync.Mutex
+	client *storage.Client
+}
 
-func (d *GCSDownloader) fileDownload(
-	ctx context.Context,
-	b *storage.BucketHandle,
-	o *storage.ObjectAttrs,
-) error {
-	r, err := b.Object(o.Name).NewReader(ctx)
-	if err != nil {
-		return err
-	}
-	defer func() {
-		_ = r.Close()
-	}()
-	if err := d.aw.WriteHeader(strings.TrimPrefix(o.Name, d.prefix), o.Size); err != nil {
-		return err
-	}
-	remaining := o.Size
-	for {
-		if remaining <= 0 {
-			break
-		}
-		sizeRead, err := r.Read(d.buffer)
+// bucketHandle returns a handle to the bucket, creating the client on first use.
+func (b *GCSBackend) bucketHandle(ctx context.Context) (*storage.BucketHandle, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.client == nil {
+		client, err := storage.NewClient(ctx)
 		if err != nil {
-			return err
+			return nil, err
 		}
-		if _, err := d.aw.Write(d.buffer[:sizeRead]); err != nil {
-			return err
-		}
-		remaining -= int64(sizeRead)
+		b.client = client
 	}
-	return nil
+	return b.client.Bucket(b.bucket), nil
 }
 
-func (d *GCSDownloader) download(ctx context.Context) error {
-	client, err := storage.NewClient(ctx)
+// ListObjects calls fn with the key, size, and ETag of every object under prefix.
+func (b *GCSBackend) ListObjects(
+	ctx context.Context, prefix string, fn func(key string, size int64, etag string) error,
+) error {
+	bucket, err := b.bucketHandle(ctx)
 	if err != nil {
 		return err
 	}
-	defer func() {
-		_ = client.Close()
-	}()
-	bucket := client.Bucket(d.bucket)
-	items := bucket.Objects(ctx, &storage.Query{Prefix: d.prefix})
+	items := bucket.Objects(ctx, &storage.Query{Prefix: prefix})
 	for {
 		item, err := items.Next()
 		if err == iterator.Done {
-			break
+			return nil
 		}
 		if err != nil {
 			return err
 		}
-		if err = d.fileDownload(ctx, bucket, item); err != nil {
+		if err = fn(item.Name, item.Size, item.Etag); err != nil {
 			return err
 		}
 	}
-	return nil
 }
 
-// Download downloads the checkpoint.
-func (d *GCSDownloader) Download(ctx context.Context) error {
-	if err := d.download(ctx); err != nil {
-		return fmt.Errorf("checkpoint download failed: %w", err)
+// OpenObject returns a reader for the content of the object with the given key.
+func (b *GCSBackend) OpenObject(ctx context.Context, key string) (io.ReadCloser, error) {
+	bucket, err := b.bucketHandle(ctx)
+	if err != nil {
+		return nil, err
 	}
-	return nil
+	return bucket.Object(key).NewReader(ctx)
 }
 
-// Close closes the underlying ArchiveWriter.
-func (d *GCSDownloader) Close() error {
-	return d.aw.Close()
+// Close closes the GCS client if one was created.
+func (b *GCSBackend) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.client == nil {
+		return nil
+	}
+	return b.client.Close()
 }
 
-// NewGCSDownloader returns a new GCSDownloader.
-func NewGCSDownloader(aw archive.ArchiveWriter, bucket string, prefix string) *GCSDownloader {
-	if !strings.HasSuffix(prefix, "/") {
-		prefix += "/"
-	}
-	return &GCSDownloader{
-		aw:     aw,
-		bucket: bucket,
-		prefix: prefix,
-		buffer: make([]byte, DefaultDownloadPartSize),
-	}
+// NewGCSBackend returns a new GCSBackend for bucket.
+func NewGCSBackend(bucket string) *GCSBackend {
+	return &GCSBackend{bucket: bucket}
 }
@@ -2,36 +2,15 @@ package s3
 
 import (
 	"context"
-	"fmt"
 	"io"
 	"strings"
+	"sync"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
-	"github.com/aws/aws-sdk-go/service/s3/s3manager"
-	"github.com/hashicorp/go-multierror"
-
-	"github.com/determined-ai/determined/master/pkg/checkpoints/archive"
 )
 
-// WriteAt writes the content in buffer p.
-func (w *seqWriterAt) WriteAt(p []byte, off int64) (int, error) {
-	if off != w.written {
-		return 0, fmt.Errorf(
-			"only supporting sequential writes,"+
-				" writing at offset %d while %d bytes have been written",
-			off, w.written)
-	}
-	n, err := w.next.Write(p)
-	w.written += int64(n)
-	if err != nil {
-		return 0, err
-	}
-
-	return n, err
-}
-
 // GetS3BucketRegion returns the region name of the specified bucket.
 // It does so by making an API call to AWS.
 func GetS3BucketRegion(ctx context.Context, bucket string) (string, error) {
@@ -52,147 +31,93 @@ func GetS3BucketRegion(ctx context.Context, bucket string) (string, error) {
 	return *out.LocationConstraint, nil
 }
 
-// S3Downloader implements downloading a checkpoint from S3
-// and sends it to the client in an archive file.
-type S3Downloader struct {
-	aw     archive.ArchiveWriter
+// S3Backend implements listing and reading checkpoint files stored in an S3 bucket.
+type S3Backend struct {
 	bucket string
-	prefix string
+
+	mu     sync.Mutex
+	client *s3.S3
 }
 
-// Download downloads the checkpoint.
-func (d *S3Downloader) Download(ctx context.Context) error {
-	region, err := GetS3BucketRegion(ctx, d.bucket)
+// s3Client returns the client for the bucket, creating it in the bucket's region on first use.
+func (b *S3Backend) s3Client(ctx context.Context) (*s3.S3, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.client != nil {
+		return b.client, nil
+	}
+	region, err := GetS3BucketRegion(ctx, b.bucket)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	sess, err := session.NewSession(&aws.Config{
 		Region: &region,
 	})
 	if err != nil {
-		return err
+		return nil, err
 	}
 	// We do not pass in credentials explicitly. Instead, we reply on
 	// the existing AWS credentials.
-	s3client := s3.New(sess)
-
-	var merr error
-	downloader := s3manager.NewDownloader(sess, func(d *s3manager.Downloader) {
-		d.Concurrency = 1 // Setting concurrency to 1 to use seqWriterAt
-	})
-	funcReadPage := func(output *s3.ListObjectsV2Output, lastPage bool) bool {
-		iter := newBatchDownloadIterator(d.aw, d.bucket, d.prefix, output.Contents)
-		// Download every bucket in this page
-		err = downloader.DownloadWithIterator(ctx, iter)
-		if iter.Err() != nil {
-			merr = multierror.Append(merr, iter.Err())
-		}
-		if err != nil {
-			merr = multierror.Append(merr, err)
-		}
+	b.client = s3.New(sess)
+	return b.client, nil
+}
 
-		// Return False to stop paging
-		return merr == nil
+// ListObjects calls fn with the key, size, and ETag of every object under prefix.
+func (b *S3Backend) ListObjects(
+	ctx context.Context, prefix string, fn func(key string, size int64, etag string) error,
+) error {
+	client, err := b.s3Client(ctx)
+	if err != nil {
+		return err
 	}
-	err = s3client.ListObjectsV2PagesWithContext(
+
+	var fnErr error
+	err = client.ListObjectsV2PagesWithContext(
 		ctx,
 		&s3.ListObjectsV2Input{
-			Bucket: &d.bucket,
-			Prefix: &d.prefix,
+			Bucket: &b.bucket,
+			Prefix: &prefix,
+		},
+		func(output *s3.ListObjectsV2Output, lastPage bool) bool {
+			for _, obj := range output.Contents {
+				// S3 returns the ETag in quotes.
+				etag := strings.Trim(aws.StringValue(obj.ETag), `"`)
+				if fnErr = fn(*obj.Key, *obj.Size, etag); fnErr != nil {
+					// Return False to stop paging
+					return false
+				}
+			}
+			return true
 		},
-		funcReadPage,
 	)
-	if err != nil {
-		merr = multierror.Append(merr, err)
-	}
-	if merr != nil {
-		return fmt.Errorf("checkpoint download failed: %w", merr)
-	}
-	return nil
-}
-
-// Close closes the underlying ArchiveWriter.
-func (d *S3Downloader) Close() error {
-	return d.aw.Close()
-}
-
-// NewS3Downloader returns a new S3Downloader.
-func NewS3Downloader(aw archive.ArchiveWriter, bucket string, prefix string) *S3Downloader {
-	return &S3Downloader{
-		aw:     aw,
-		bucket: bucket,
-		prefix: prefix,
+	if fnErr != nil {
+		return fnErr
 	}
+	return err
 }
 
-// seqWriterAt satisfies S3 APIs' io.WriterAt interface while staying sequential.
-// To use it with s3manager.Downloader, its concurrency needs be set to 1.
-// Ref: https://docs.aws.amazon.com/sdk-for-go/api/service/s3/s3manager/#Downloader
-type seqWriterAt struct {
-	next    io.Writer
-	written int64
-}
-
-func newSeqWriterAt(w io.Writer) *seqWriterAt {
-	return &seqWriterAt{next: w}
-}
-
-// BatchDownloadIterator implements s3's BatchDownloadIterator API.
-type batchDownloadIterator struct {
-	// S3 config
-	bucket string
-	prefix string
-	// The objects we are writing
-	objects []*s3.Object
-	// The output we are writing to
-	aw archive.ArchiveWriter
-	// Internal states
-	err error
-	pos int
-}
-
-// Next() returns true if the next item is available.
-func (i *batchDownloadIterator) Next() bool {
-	i.pos++
-	if i.pos == len(i.objects) {
-		return false
+// OpenObject returns a reader for the content of the object with the given key.
+func (b *S3Backend) OpenObject(ctx context.Context, key string) (io.ReadCloser, error) {
+	client, err := b.s3Client(ctx)
+	if err != nil {
+		return nil, err
 	}
-	pathname := strings.TrimPrefix(*i.objects[i.pos].Key, i.prefix)
-	err := i.aw.WriteHeader(pathname, *i.objects[i.pos].Size)
+	out, err := client.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: &b.bucket,
+		Key:    &key,
+	})
 	if err != nil {
-		i.err = err
-		return false
+		return nil, err
 	}
-	return true
-}
-
-// Err() returns the error if any.
-func (i *batchDownloadIterator) Err() error {
-	return i.err
+	return out.Body, nil
 }
 
-// DownloadObject() returns a DownloadObject.
-func (i *batchDownloadIterator) DownloadObject() s3manager.BatchDownloadObject {
-	return s3manager.BatchDownloadObject{
-		Object: &s3.GetObjectInput{
-			Bucket: &i.bucket,
-			Key:    i.objects[i.pos].Key,
-		},
-		Writer: newSeqWriterAt(i.aw),
-	}
+// Close is a no-op since S3 clients hold no resources.
+func (b *S3Backend) Close() error {
+	return nil
 }
 
-func newBatchDownloadIterator(aw archive.ArchiveWriter,
-	bucket string, prefix string, objs []*s3.Object,
-) *batchDownloadIterator {
-	if !strings.HasSuffix(prefix, "/") {
-		prefix += "/"
-	}
-	return &batchDownloadIterator{
-		aw:      aw,
-		bucket:  bucket,
-		prefix:  prefix,
-		objects: objs,
-		pos:     -1,
-	}
+// NewS3Backend returns a new S3Backend for bucket.
+func NewS3Backend(bucket string) *S3Backend {
+	return &S3Backend{bucket: bucket}
 }
@@ -0,0 +1,100 @@
+package sharedfs
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// SharedFSBackend implements listing and reading checkpoint files stored on a shared filesystem
+// that is mounted on the master.
+type SharedFSBackend struct {
+	storagePath string
+}
+
+// resolve returns the path of the file or directory with the given key. Keys that resolve to a
+// path outside of the storage path, e.g. through ".." or symbolic links, are rejected.
+func (b *SharedFSBackend) resolve(key string) (string, error) {
+	root, err := filepath.EvalSymlinks(b.storagePath)
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(root, filepath.FromSlash(key))
+	if isWithin(root, path) {
+		if path, err = filepath.EvalSymlinks(path); err != nil {
+			return "", err
+		}
+	}
+	if !isWithin(root, path) {
+		return "", fmt.Errorf("%s is outside of the checkpoint storage path %s",
+			key, b.storagePath)
+	}
+	return path, nil
+}
+
+func isWithin(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// ListObjects calls fn with the key and size of every regular file in the directory prefix, in
+// lexical order. Files have no ETag. Keys start with prefix even if the directory is a symbolic
+// link to elsewhere in the storage path.
+func (b *SharedFSBackend) ListObjects(
+	ctx context.Context, prefix string, fn func(key string, size int64, etag string) error,
+) error {
+	prefix = strings.TrimSuffix(prefix, "/")
+	dir, err := b.resolve(prefix)
+	if err != nil {
+		return err
+	}
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		// Symbolic links are skipped, since they may point outside of the storage path.
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if prefix != "" {
+			key = prefix + "/" + key
+		}
+		return fn(key, info.Size(), "")
+	})
+}
+
+// OpenObject returns a reader for the content of the file with the given key.
+func (b *SharedFSBackend) OpenObject(_ context.Context, key string) (io.ReadCloser, error) {
+	path, err := b.resolve(key)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(path) //nolint:gosec // The path is checked to be under the storage path.
+}
+
+// Close is a no-op since the shared filesystem backend holds no resources.
+func (b *SharedFSBackend) Close() error {
+	return nil
+}
+
+// NewSharedFSBackend returns a new SharedFSBackend for the checkpoint storage directory at
+// storagePath.
+func NewSharedFSBackend(storagePath string) *SharedFSBackend {
+	return &SharedFSBackend{storagePath: storagePath}
+}
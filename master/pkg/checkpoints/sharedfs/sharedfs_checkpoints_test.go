@@ -0,0 +1,78 @@
+package sharedfs
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSharedFSBackend(t *testing.T) {
+	ctx := context.Background()
+	storagePath := t.TempDir()
+	outside := t.TempDir()
+	id := "7e0bad2c-b3f6-4988-916c-eb3081b19db0"
+
+	files := map[string]string{
+		id + "/data.txt":    "This is mock data.",
+		id + "/lib/math.py": "def triple(x):\n  return x * 3",
+	}
+	for key, content := range files {
+		path := filepath.Join(storagePath, filepath.FromSlash(key))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o700))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(outside, "secret"), []byte("secret"), 0o600))
+	require.NoError(t, os.Symlink(
+		filepath.Join(outside, "secret"), filepath.Join(storagePath, id, "link")))
+	require.NoError(t, os.Symlink(outside, filepath.Join(storagePath, "escape")))
+
+	b := NewSharedFSBackend(storagePath)
+	listed := map[string]int64{}
+	require.NoError(t, b.ListObjects(ctx, id+"/", func(key string, size int64, _ string) error {
+		listed[key] = size
+		return nil
+	}))
+	require.Equal(t, map[string]int64{
+		id + "/data.txt":    int64(len(files[id+"/data.txt"])),
+		id + "/lib/math.py": int64(len(files[id+"/lib/math.py"])),
+	}, listed)
+
+	r, err := b.OpenObject(ctx, id+"/lib/math.py")
+	require.NoError(t, err)
+	content, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.NoError(t, r.Close())
+	require.Equal(t, files[id+"/lib/math.py"], string(content))
+
+	for _, key := range []string{"../secret", id + "/../../secret", id + "/link", "escape/secret"} {
+		_, err := b.OpenObject(ctx, key)
+		require.ErrorContains(t, err, "outside of the checkpoint storage path", key)
+	}
+	require.ErrorContains(t, b.ListObjects(ctx, "escape/", func(string, int64, string) error {
+		return nil
+	}), "outside of the checkpoint storage path")
+
+	// A checkpoint directory that links elsewhere in the storage path keeps its own keys.
+	alias := "0b7e6f2a-6c1e-4a43-9e2f-2d6f3c1b8a55"
+	require.NoError(t, os.Symlink(
+		filepath.Join(storagePath, id), filepath.Join(storagePath, alias)))
+	listed = map[string]int64{}
+	require.NoError(t, b.ListObjects(ctx, alias+"/", func(key string, size int64, _ string) error {
+		listed[key] = size
+		return nil
+	}))
+	require.Equal(t, map[string]int64{
+		alias + "/data.txt":    int64(len(files[id+"/data.txt"])),
+		alias + "/lib/math.py": int64(len(files[id+"/lib/math.py"])),
+	}, listed)
+	r, err = b.OpenObject(ctx, alias+"/lib/math.py")
+	require.NoError(t, err)
+	content, err = io.ReadAll(r)
+	require.NoError(t, err)
+	require.NoError(t, r.Close())
+	require.Equal(t, files[id+"/lib/math.py"], string(content))
+}
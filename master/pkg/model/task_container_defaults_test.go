@@ -5,43 +5,144 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/require"
+	k8sV1 "k8s.io/api/core/v1"
 
 	"github.com/determined-ai/determined/master/pkg/schemas/expconf"
 )
 
 func TestEnvironmentVarsDefaultMerging(t *testing.T) {
 	gpuType := "tesla"
+	slurmSlotsPerNode := 4
+	expconfSlotsPerNode := 8
 	pbsSlotsPerNode := 99
 	defaults := &TaskContainerDefaultsConfig{
 		EnvironmentVariables: &RuntimeItems{
-			CPU:  []string{"cpu=default"},
+			CPU:  []string{"cpu=default", "shared=value", "FOO=1", "BARE"},
 			CUDA: []string{"cuda=default"},
 			ROCM: []string{"rocm=default"},
 		},
 		Slurm: expconf.SlurmConfigV0{
-			RawGpuType: &gpuType,
+			RawGpuType:      &gpuType,
+			RawSlotsPerNode: &slurmSlotsPerNode,
+			RawSbatchArgs:   []string{"--partition=default", "--exclusive"},
 		},
 		Pbs: expconf.PbsConfigV0{
 			RawSlotsPerNode: &pbsSlotsPerNode,
+			RawSbatchArgs:   []string{"-q default"},
 		},
 	}
 	conf := expconf.ExperimentConfig{
 		RawEnvironment: &expconf.EnvironmentConfig{
 			RawEnvironmentVariables: &expconf.EnvironmentVariablesMap{
-				RawCPU:  []string{"cpu=expconf"},
+				RawCPU:  []string{"cpu=expconf", "shared=value", "FOO=2", "BARE"},
 				RawCUDA: []string{"extra=expconf"},
 			},
 		},
+		RawSlurmConfig: &expconf.SlurmConfig{
+			RawSlotsPerNode: &expconfSlotsPerNode,
+			RawSbatchArgs:   []string{"--partition=expconf"},
+		},
+		RawPbsConfig: &expconf.PbsConfig{
+			RawSbatchArgs: []string{"-q expconf"},
+		},
 	}
 	defaults.MergeIntoExpConfig(&conf)
 
 	require.Equal(t, conf.RawEnvironment.RawEnvironmentVariables,
 		&expconf.EnvironmentVariablesMap{
-			RawCPU:  []string{"cpu=default", "cpu=expconf"},
+			// Entries identical in both the defaults and expconf only appear once, and
+			// expconf values replace defaults for the same key.
+			RawCPU:  []string{"BARE", "cpu=expconf", "shared=value", "FOO=2"},
 			RawCUDA: []string{"cuda=default", "extra=expconf"},
 			RawROCM: []string{"rocm=default"},
 		})
 
 	require.Equal(t, *conf.RawSlurmConfig.RawGpuType, gpuType)
+	require.Equal(t, *conf.RawSlurmConfig.RawSlotsPerNode, expconfSlotsPerNode)
+	// Launcher args are concatenated with expconf's last, so that they take precedence.
+	require.Equal(t, conf.RawSlurmConfig.RawSbatchArgs,
+		[]string{"--partition=default", "--exclusive", "--partition=expconf"})
 	require.Equal(t, *conf.RawPbsConfig.RawSlotsPerNode, pbsSlotsPerNode)
+	require.Equal(t, conf.RawPbsConfig.RawSbatchArgs, []string{"-q default", "-q expconf"})
+
+	// Defaults alone are copied over unchanged.
+	conf = expconf.ExperimentConfig{}
+	defaults.MergeIntoExpConfig(&conf)
+	require.Equal(t, conf.RawSlurmConfig.RawSbatchArgs, []string{"--partition=default", "--exclusive"})
+	require.Equal(t, conf.RawPbsConfig.RawSbatchArgs, []string{"-q default"})
+}
+
+func TestPodSpecsDefaultMerging(t *testing.T) {
+	defaultToleration := k8sV1.Toleration{
+		Key: "dedicated", Operator: k8sV1.TolerationOpEqual, Value: "determined",
+	}
+	gpuToleration := k8sV1.Toleration{
+		Key: "nvidia.com/gpu", Operator: k8sV1.TolerationOpExists,
+	}
+	expconfToleration := k8sV1.Toleration{
+		Key: "team", Operator: k8sV1.TolerationOpEqual, Value: "research",
+	}
+	defaults := &TaskContainerDefaultsConfig{
+		CPUPodSpec: &k8sV1.Pod{
+			Spec: k8sV1.PodSpec{
+				NodeSelector: map[string]string{"pool": "cpu", "zone": "default"},
+				Tolerations:  []k8sV1.Toleration{defaultToleration},
+				Volumes:      []k8sV1.Volume{{Name: "cpu-cache"}},
+			},
+		},
+		GPUPodSpec: &k8sV1.Pod{
+			Spec: k8sV1.PodSpec{
+				NodeSelector: map[string]string{"pool": "gpu", "zone": "default"},
+				Tolerations:  []k8sV1.Toleration{defaultToleration, gpuToleration},
+				Volumes:      []k8sV1.Volume{{Name: "gpu-cache"}, {Name: "shared"}},
+			},
+		},
+	}
+
+	for _, slots := range []int{0, 2} {
+		expconfPod := k8sV1.Pod{
+			Spec: k8sV1.PodSpec{
+				NodeSelector: map[string]string{"zone": "expconf"},
+				Tolerations:  []k8sV1.Toleration{expconfToleration, defaultToleration},
+				Volumes: []k8sV1.Volume{{
+					Name: "shared",
+					VolumeSource: k8sV1.VolumeSource{
+						EmptyDir: &k8sV1.EmptyDirVolumeSource{},
+					},
+				}},
+			},
+		}
+		conf := expconf.ExperimentConfig{
+			RawResources: &expconf.ResourcesConfig{
+				RawSlotsPerTrial: &slots,
+			},
+			RawEnvironment: &expconf.EnvironmentConfig{
+				RawPodSpec: (*expconf.PodSpec)(&expconfPod),
+			},
+		}
+		defaults.MergeIntoExpConfig(&conf)
+		spec := conf.RawEnvironment.RawPodSpec.Spec
+
+		if slots == 0 {
+			require.Equal(t, map[string]string{"pool": "cpu", "zone": "expconf"}, spec.NodeSelector)
+			require.Equal(t, []k8sV1.Toleration{expconfToleration, defaultToleration},
+				spec.Tolerations)
+			require.Equal(t, []string{"shared", "cpu-cache"}, volumeNames(spec.Volumes))
+		} else {
+			require.Equal(t, map[string]string{"pool": "gpu", "zone": "expconf"}, spec.NodeSelector)
+			require.Equal(t, []k8sV1.Toleration{expconfToleration, defaultToleration, gpuToleration},
+				spec.Tolerations)
+			require.Equal(t, []string{"shared", "gpu-cache"}, volumeNames(spec.Volumes))
+		}
+		// The expconf volume wins over the default volume with the same name.
+		require.NotNil(t, spec.Volumes[0].EmptyDir)
+	}
+}
+
+func volumeNames(volumes []k8sV1.Volume) []string {
+	var names []string
+	for _, v := range volumes {
+		names = append(names, v.Name)
+	}
+	return names
 }